@@ -0,0 +1,105 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package lxr
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Access traces record every ByteMap index read while hashing, for studying how hashing uses
+// the memory hierarchy, e.g. with cmd/lxrcachesim.
+//
+//	offset  size  field
+//	     0     8  magic "LXRTRACE"
+//	     8     8  map size in bits
+//	    16     8  first index read
+//	    24     8  second index read ...
+//
+// All integers are big endian, as in table files.  Indices are offsets into the ByteMap, in
+// the order the reads are made.
+const accessMagic = "LXRTRACE"
+
+// AccessRecorder hashes, writing every ByteMap index read to an access trace
+type AccessRecorder struct {
+	lx       *LXRHash
+	w        *bufio.Writer
+	buf      [8]byte
+	accesses uint64
+	err      error
+}
+
+// NewAccessRecorder returns an AccessRecorder writing an access trace to w.  Call Flush when
+// done.
+func (lx *LXRHash) NewAccessRecorder(w io.Writer) *AccessRecorder {
+	r := &AccessRecorder{lx: lx, w: bufio.NewWriter(w)}
+	r.w.WriteString(accessMagic)
+	r.put(lx.MapSizeBits)
+	return r
+}
+
+// put writes one big endian integer
+func (r *AccessRecorder) put(v uint64) {
+	binary.BigEndian.PutUint64(r.buf[:], v)
+	if _, err := r.w.Write(r.buf[:]); err != nil && r.err == nil {
+		r.err = err
+	}
+}
+
+// Hash returns the hash of src, recording the ByteMap reads it makes
+func (r *AccessRecorder) Hash(src []byte) []byte {
+	return r.lx.HashTrace(src, func(st *TraceStep) {
+		for _, read := range st.Reads {
+			r.put(read.Index)
+		}
+		r.accesses += uint64(len(st.Reads))
+	})
+}
+
+// Accesses returns the number of reads recorded
+func (r *AccessRecorder) Accesses() uint64 {
+	return r.accesses
+}
+
+// Flush writes any buffered reads, and returns the first error writing the trace
+func (r *AccessRecorder) Flush() error {
+	if err := r.w.Flush(); err != nil && r.err == nil {
+		r.err = err
+	}
+	return r.err
+}
+
+// AccessTraceReader reads an access trace written by an AccessRecorder
+type AccessTraceReader struct {
+	MapSizeBits uint64 // Size of the ByteMap the trace was recorded with
+	r           *bufio.Reader
+	buf         [8]byte
+}
+
+// NewAccessTraceReader reads the header of an access trace
+func NewAccessTraceReader(r io.Reader) (*AccessTraceReader, error) {
+	tr := &AccessTraceReader{r: bufio.NewReader(r)}
+	head := make([]byte, len(accessMagic)+8)
+	if _, err := io.ReadFull(tr.r, head); err != nil {
+		return nil, fmt.Errorf("reading access trace header: %v", err)
+	}
+	if !bytes.Equal(head[:len(accessMagic)], []byte(accessMagic)) {
+		return nil, fmt.Errorf("not an access trace")
+	}
+	tr.MapSizeBits = binary.BigEndian.Uint64(head[len(accessMagic):])
+	return tr, nil
+}
+
+// Next returns the next index read, or io.EOF at the end of the trace
+func (tr *AccessTraceReader) Next() (uint64, error) {
+	if _, err := io.ReadFull(tr.r, tr.buf[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return 0, fmt.Errorf("access trace is truncated")
+		}
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(tr.buf[:]), nil
+}
@@ -0,0 +1,63 @@
+package lxr
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestAccessRecorder(t *testing.T) {
+	l := diffHasher(t, Params{Seed: Seed, MapSizeBits: 10, HashSize: 256, Passes: Passes})
+	inputs := [][]byte{[]byte("foo"), []byte("a longer input")}
+
+	var want []uint64
+	for _, src := range inputs {
+		l.HashTrace(src, func(st *TraceStep) {
+			for _, r := range st.Reads {
+				want = append(want, r.Index)
+			}
+		})
+	}
+
+	var buf bytes.Buffer
+	rec := l.NewAccessRecorder(&buf)
+	for _, src := range inputs {
+		if got := rec.Hash(src); !bytes.Equal(got, l.Hash(src)) {
+			t.Errorf("%q: got = %x, want = %x", src, got, l.Hash(src))
+		}
+	}
+	if err := rec.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Accesses() != uint64(len(want)) {
+		t.Errorf("accesses: got = %d, want = %d", rec.Accesses(), len(want))
+	}
+
+	tr, err := NewAccessTraceReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr.MapSizeBits != 10 {
+		t.Errorf("map size: got = %d bits, want = 10", tr.MapSizeBits)
+	}
+	for i, w := range want {
+		got, err := tr.Next()
+		if err != nil {
+			t.Fatalf("read %d: %v", i, err)
+		}
+		if got != w {
+			t.Fatalf("read %d: got = %x, want = %x", i, got, w)
+		}
+	}
+	if _, err := tr.Next(); err != io.EOF {
+		t.Errorf("end of trace: got %v, want %v", err, io.EOF)
+	}
+
+	if _, err := NewAccessTraceReader(bytes.NewBufferString("LXRTABLE\x00\x00\x00\x00\x00\x00\x00\x0a")); err == nil {
+		t.Error("read a table file as an access trace")
+	}
+	tr, _ = NewAccessTraceReader(bytes.NewBufferString("LXRTRACE\x00\x00\x00\x00\x00\x00\x00\x0a\x00\x01"))
+	if _, err := tr.Next(); err == nil || err == io.EOF {
+		t.Errorf("truncated trace: got %v", err)
+	}
+}
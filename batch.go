@@ -0,0 +1,231 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package lxr
+
+import (
+	"sort"
+	"sync"
+)
+
+// DefaultBatchWidth is the interleave width used by NewBatchHasher when none is given
+const DefaultBatchWidth = 16
+
+// BatchHasher hashes batches of inputs that share a base, as HashParallel does, but without
+// allocating.  HashParallel uses one from a pool.
+//
+// Hashing is dominated by the latency of random reads of the ByteMap, and each read depends
+// on the one before it.  A BatchHasher runs width hashes in lock step so their reads can be
+// in flight together.  The state of the hashes is kept in one array per variable, indexed by
+// lane, and all buffers are reused from one call to the next, so hashing a batch does not
+// allocate once the buffers have grown to fit.
+//
+// A BatchHasher is not safe for concurrent use; give each goroutine its own.
+type BatchHasher struct {
+	lx    *LXRHash
+	width int
+
+	as, s1, s2, s3, v2 []uint64 // State of each lane
+	hs                 []uint64 // Intermediate results, hs[idx*width+lane]
+
+	order   []int    // Batch indexes, longest input first
+	batch   [][]byte // The batch being hashed, for sorting order
+	out     []byte   // Backing store of results
+	results [][]byte // Returned by Hash
+}
+
+// NewBatchHasher returns a BatchHasher interleaving width hashes, or DefaultBatchWidth if
+// width is not positive.  The best width depends on the CPU and the size of the ByteMap;
+// Calibrate can find it.
+func (lx *LXRHash) NewBatchHasher(width int) *BatchHasher {
+	bh := new(BatchHasher)
+	bh.reset(lx, width)
+	return bh
+}
+
+// reset makes bh hash with lx, interleaving width hashes, reusing its buffers where they
+// are large enough
+func (bh *BatchHasher) reset(lx *LXRHash, width int) {
+	if width <= 0 {
+		width = DefaultBatchWidth
+	}
+	bh.lx, bh.width = lx, width
+	if cap(bh.as) < width {
+		bh.as = make([]uint64, width)
+		bh.s1 = make([]uint64, width)
+		bh.s2 = make([]uint64, width)
+		bh.s3 = make([]uint64, width)
+		bh.v2 = make([]uint64, width)
+	}
+	bh.as, bh.s1, bh.s2, bh.s3, bh.v2 = bh.as[:width], bh.s1[:width], bh.s2[:width], bh.s3[:width], bh.v2[:width]
+	if n := width * int(lx.HashSize); cap(bh.hs) < n {
+		bh.hs = make([]uint64, n)
+	}
+}
+
+// batchers holds the BatchHashers used by HashBatch between calls
+var batchers = sync.Pool{New: func() interface{} { return new(BatchHasher) }}
+
+// getBatchHasher returns a pooled BatchHasher hashing with lx, interleaving width hashes.
+// Return it with putBatchHasher.
+func getBatchHasher(lx *LXRHash, width int) *BatchHasher {
+	bh := batchers.Get().(*BatchHasher)
+	bh.reset(lx, width)
+	return bh
+}
+
+// putBatchHasher returns a BatchHasher to the pool
+func putBatchHasher(bh *BatchHasher) {
+	bh.lx = nil // Do not keep the ByteMap alive from the pool
+	batchers.Put(bh)
+}
+
+// hashBatch hashes base followed by each entry of batch with a pooled BatchHasher
+// interleaving width hashes.  Unlike those of a BatchHasher, the results are the caller's.
+func (lx *LXRHash) hashBatch(base []byte, batch [][]byte, width int) ([][]byte, error) {
+	bh := getBatchHasher(lx, width)
+	defer putBatchHasher(bh)
+	results, err := bh.Hash(base, batch)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(results)*int(lx.HashSize))
+	ret := make([][]byte, len(results))
+	for i, r := range results {
+		ret[i] = out[:len(r):len(r)]
+		copy(ret[i], r)
+		out = out[len(r):]
+	}
+	return ret, nil
+}
+
+// Width returns the number of hashes interleaved
+func (bh *BatchHasher) Width() int {
+	return bh.width
+}
+
+// Hash returns the hash of base followed by each entry of batch, identical to Hash over the
+// same input.  Items may differ in length.  The results are only valid until the next call.
+// Returns ErrEmptyBatch if the batch has no entries, and ErrNoTable if the ByteMap is not loaded.
+func (bh *BatchHasher) Hash(base []byte, batch [][]byte) ([][]byte, error) {
+	lx := bh.lx
+	if len(batch) == 0 {
+		return nil, ErrEmptyBatch
+	}
+	if lx.MapSize == 0 || uint64(len(lx.ByteMap)) != lx.MapSize {
+		return nil, ErrNoTable
+	}
+
+	size := int(lx.HashSize)
+	if cap(bh.out) < len(batch)*size {
+		bh.out = make([]byte, len(batch)*size)
+	}
+	if cap(bh.results) < len(batch) {
+		bh.results = make([][]byte, len(batch))
+		bh.order = make([]int, len(batch))
+	}
+	bh.out = bh.out[:len(batch)*size]
+	bh.results = bh.results[:len(batch)]
+	bh.order = bh.order[:len(batch)]
+	for i := range bh.results {
+		bh.results[i] = bh.out[i*size : (i+1)*size : (i+1)*size]
+	}
+
+	// Longest items first, so the lanes still being fed input are always a prefix
+	sorted := true
+	for i := range bh.order {
+		bh.order[i] = i
+		sorted = sorted && (i == 0 || len(batch[i]) <= len(batch[i-1]))
+	}
+	if !sorted {
+		bh.batch = batch
+		sort.Stable((*batchOrder)(bh))
+		bh.batch = nil
+	}
+
+	for start := 0; start < len(batch); start += bh.width {
+		end := start + bh.width
+		if end > len(batch) {
+			end = len(batch)
+		}
+		bh.hashLanes(base, batch, bh.order[start:end])
+	}
+	return bh.results, nil
+}
+
+// hashLanes hashes base followed by the batch entries at order, one per lane
+func (bh *BatchHasher) hashLanes(base []byte, batch [][]byte, order []int) {
+	lx := bh.lx
+	lanes := len(order)
+	for k := 0; k < lanes; k++ {
+		bh.as[k], bh.s1[k], bh.s2[k], bh.s3[k] = lx.Seed, 0, 0, 0
+	}
+	hs := bh.hs[:int(lx.HashSize)*bh.width]
+	for i := range hs {
+		hs[i] = 0
+	}
+
+	length := len(base) + len(batch[order[0]])
+	active := lanes
+	// load sets v2 to the input byte at position i of each active lane
+	load := func(i int) {
+		for active > 0 && i >= len(base)+len(batch[order[active-1]]) {
+			active--
+		}
+		v2 := bh.v2[:active]
+		if i < len(base) {
+			for k := range v2 {
+				v2[k] = uint64(base[i])
+			}
+			return
+		}
+		for k := range v2 {
+			v2[k] = uint64(batch[order[k]][i-len(base)])
+		}
+	}
+
+	idx := 0
+	// Fast spin to prevent caching state
+	for i := 0; i < length; i++ {
+		if idx >= int(lx.HashSize) { // Use an if to avoid modulo math
+			idx = 0
+		}
+		load(i)
+		bh.faststep(active, idx)
+		idx++
+	}
+
+	active = lanes
+	idx = 0
+	// Actual work to compute the hash
+	for i := 0; i < length; i++ {
+		if idx >= int(lx.HashSize) {
+			idx = 0
+		}
+		load(i)
+		bh.step(active, idx)
+		idx++
+	}
+
+	// Reduction pass
+	mk := lx.MapSize - 1
+	bm := lx.ByteMap
+	for i := int(lx.HashSize) - 1; i >= 0; i-- {
+		row := hs[i*bh.width : i*bh.width+lanes]
+		v2 := bh.v2[:lanes]
+		copy(v2, row)
+		bh.step(lanes, i)
+		as := bh.as[:lanes]
+		for k, n := range order {
+			bh.results[n][i] = bm[as[k]&mk] ^ bm[row[k]&mk] // Xor two resulting sequences
+		}
+	}
+}
+
+// batchOrder sorts the order of a BatchHasher by decreasing input length
+type batchOrder BatchHasher
+
+func (o *batchOrder) Len() int { return len(o.order) }
+func (o *batchOrder) Less(i, j int) bool {
+	return len(o.batch[o.order[i]]) > len(o.batch[o.order[j]])
+}
+func (o *batchOrder) Swap(i, j int) { o.order[i], o.order[j] = o.order[j], o.order[i] }
@@ -0,0 +1,67 @@
+package lxr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func TestBatchHasher(t *testing.T) {
+	rand.Seed(2)
+	for _, width := range []int{0, 1, 3, 16, 64} {
+		bh := lx.NewBatchHasher(width)
+		for round := 0; round < 10; round++ {
+			base := make([]byte, rand.Intn(40))
+			rand.Read(base)
+			batch := make([][]byte, 1+rand.Intn(40))
+			for i := range batch {
+				batch[i] = make([]byte, rand.Intn(80))
+				rand.Read(batch[i])
+			}
+
+			results, err := bh.Hash(base, batch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != len(batch) {
+				t.Fatalf("width %d: got %d results, want %d", width, len(results), len(batch))
+			}
+			for i := range batch {
+				want := lx.Hash(append(append([]byte(nil), base...), batch[i]...))
+				if !bytes.Equal(results[i], want) {
+					t.Errorf("width %d, item %d of %d bytes: got = %x, want = %x", width, i, len(batch[i]), results[i], want)
+				}
+			}
+		}
+	}
+}
+
+func TestBatchHasher_Allocs(t *testing.T) {
+	bh := lx.NewBatchHasher(8)
+	batch := make([][]byte, 20)
+	for i := range batch {
+		batch[i] = make([]byte, 4)
+		binary.BigEndian.PutUint32(batch[i], uint32(i))
+	}
+	batch[3] = batch[3][:2] // mixed lengths are sorted without allocating
+	allocs := testing.AllocsPerRun(10, func() {
+		if _, err := bh.Hash(oprhash, batch); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("BatchHasher allocates: %v allocs/op", allocs)
+	}
+}
+
+func TestBatchHasher_Errors(t *testing.T) {
+	if _, err := lx.NewBatchHasher(0).Hash(oprhash, nil); !errors.Is(err, ErrEmptyBatch) {
+		t.Errorf("empty batch: got = %v, want = %v", err, ErrEmptyBatch)
+	}
+	none := &LXRHash{HashSize: 32}
+	if _, err := none.NewBatchHasher(0).Hash(oprhash, [][]byte{{1}}); !errors.Is(err, ErrNoTable) {
+		t.Errorf("no table: got = %v, want = %v", err, ErrNoTable)
+	}
+}
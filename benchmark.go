@@ -22,8 +22,41 @@ func (lx LXRHash) BenchmarkFlatHash(ctx context.Context, duration time.Duration,
 	return benchFunc(ctx, duration, goroutines, lx.FlatHash)
 }
 
+// BenchmarkBatch will run a benchmark for the specified duration using a BatchHasher of the given
+// width per goroutine, each hashing batches of batchSize nonces.
+// Returns the number of hashes calculated and the real duration of the benchmark.
+// If no goroutines are specified it will use the total number of available cores.
+func (lx LXRHash) BenchmarkBatch(ctx context.Context, duration time.Duration, goroutines uint, width, batchSize int) (uint64, time.Duration) {
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+	return benchRun(ctx, duration, goroutines, func(ctx context.Context, id byte, count *uint64, base []byte) {
+		benchBatchMiner(ctx, id, count, base, lx.NewBatchHasher(width).Hash, batchSize)
+	})
+}
+
+// BenchmarkHashParallel will run a benchmark for the specified duration using the HashParallel function,
+// each goroutine hashing batches of batchSize nonces.
+// Returns the number of hashes calculated and the real duration of the benchmark.
+// If no goroutines are specified it will use the total number of available cores.
+func (lx LXRHash) BenchmarkHashParallel(ctx context.Context, duration time.Duration, goroutines uint, batchSize int) (uint64, time.Duration) {
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+	return benchRun(ctx, duration, goroutines, func(ctx context.Context, id byte, count *uint64, base []byte) {
+		benchBatchMiner(ctx, id, count, base, lx.HashBatch, batchSize)
+	})
+}
+
 // benchmark a specific function. cancels early if context is cancelled, otherwise runs for duration
 func benchFunc(ctx context.Context, duration time.Duration, goroutines uint, f func([]byte) []byte) (uint64, time.Duration) {
+	return benchRun(ctx, duration, goroutines, func(ctx context.Context, id byte, count *uint64, base []byte) {
+		benchMiner(ctx, id, count, base, f)
+	})
+}
+
+// run a mining thread per goroutine. cancels early if context is cancelled, otherwise runs for duration
+func benchRun(ctx context.Context, duration time.Duration, goroutines uint, miner func(context.Context, byte, *uint64, []byte)) (uint64, time.Duration) {
 	if goroutines == 0 {
 		goroutines = uint(runtime.NumCPU())
 	}
@@ -40,7 +73,7 @@ func benchFunc(ctx context.Context, duration time.Duration, goroutines uint, f f
 
 	start := time.Now()
 	for i := 0; i < int(goroutines); i++ {
-		go benchMiner(myctx, byte(i), &hashes, base, f)
+		go miner(myctx, byte(i), &hashes, base)
 	}
 
 	<-myctx.Done()
@@ -64,3 +97,25 @@ func benchMiner(ctx context.Context, id byte, count *uint64, base []byte, f func
 		}
 	}
 }
+
+// individual batch mining thread
+func benchBatchMiner(ctx context.Context, id byte, count *uint64, base []byte, f func([]byte, [][]byte) ([][]byte, error), batchSize int) {
+	batch := make([][]byte, batchSize)
+	for j := range batch {
+		batch[j] = []byte{id, 0, 0, 0, 0}
+	}
+	i := uint32(0)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+			for _, nonce := range batch {
+				binary.BigEndian.PutUint32(nonce[1:], i)
+				i++
+			}
+			f(base, batch)
+			atomic.AddUint64(count, uint64(batchSize))
+		}
+	}
+}
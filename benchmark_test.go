@@ -120,3 +120,13 @@ func Test_benchFunc(t *testing.T) {
 		t.Errorf("Cancelling took too long. cancelDuration = %s, benchDuration = %s", cancelDuration, duration)
 	}
 }
+
+func TestLXRHash_BenchmarkBatch(t *testing.T) {
+	hashes, duration := lx.BenchmarkBatch(context.Background(), time.Millisecond*100, 1, 4, 8)
+	if hashes == 0 || hashes%8 != 0 {
+		t.Errorf("hashes not counted in whole batches: %d", hashes)
+	}
+	if duration < time.Millisecond*100 {
+		t.Errorf("benchmark ended early: %s", duration)
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package lxr
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Hash and FlatHash compute the same hashes, as do BatchHashers of any width, but which is
+// fastest depends on the CPU, its caches and the size of the ByteMap.  Calibrate benchmarks them
+// briefly on the host and NewHasher returns a TunedHasher using the fastest.
+
+// Kernels for single hashes
+const (
+	KernelHash     = "hash"      // Hash
+	KernelFlatHash = "flat hash" // FlatHash
+)
+
+// calibrationWidths are the BatchHasher widths tried by Calibrate
+var calibrationWidths = []int{4, 8, 16, 32, 64}
+
+// calibrationBatchSize is the number of nonces per batch when calibrating batch hashing
+const calibrationBatchSize = 128
+
+// Calibration records the fastest way to hash on a host with a parameter set
+type Calibration struct {
+	Host       string             // Host the calibration was made on, see HostID
+	Params     Params             // Parameters of the hash space
+	Kernel     string             // Fastest kernel for single hashes, KernelHash or KernelFlatHash
+	BatchWidth int                // Fastest BatchHasher width, or 0 for DefaultBatchWidth
+	Rates      map[string]float64 // Hashes per second for every candidate
+}
+
+// HostID identifies the host and how much of it the process can use, so calibrations are
+// not reused on other hardware
+func HostID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s/%s/%s/%d", host, runtime.GOOS, runtime.GOARCH, runtime.NumCPU())
+}
+
+// Calibrate benchmarks each way of hashing for an equal share of duration, using every
+// core, and returns the fastest.  Returns ctx.Err() if ctx is cancelled first.
+func (lx *LXRHash) Calibrate(ctx context.Context, duration time.Duration) (Calibration, error) {
+	if lx.MapSize == 0 || uint64(len(lx.ByteMap)) != lx.MapSize {
+		return Calibration{}, ErrNoTable
+	}
+
+	type candidate struct {
+		name  string
+		bench func(time.Duration) (uint64, time.Duration)
+	}
+	candidates := []candidate{
+		{KernelHash, func(d time.Duration) (uint64, time.Duration) { return lx.BenchmarkHash(ctx, d, 0) }},
+		{KernelFlatHash, func(d time.Duration) (uint64, time.Duration) { return lx.BenchmarkFlatHash(ctx, d, 0) }},
+	}
+	for _, width := range calibrationWidths {
+		width := width
+		candidates = append(candidates, candidate{batchKernel(width), func(d time.Duration) (uint64, time.Duration) {
+			return lx.BenchmarkBatch(ctx, d, 0, width, calibrationBatchSize)
+		}})
+	}
+
+	c := Calibration{Host: HostID(), Params: lx.Params(), Rates: make(map[string]float64)}
+	share := duration / time.Duration(len(candidates))
+	for _, cand := range candidates {
+		hashes, took := cand.bench(share)
+		if err := ctx.Err(); err != nil {
+			return Calibration{}, err
+		}
+		c.Rates[cand.name] = float64(hashes) / took.Seconds()
+		lx.log().Debug("calibrated", "kernel", cand.name, "hps", c.Rates[cand.name])
+	}
+
+	c.Kernel = KernelHash
+	if c.Rates[KernelFlatHash] > c.Rates[KernelHash] {
+		c.Kernel = KernelFlatHash
+	}
+	best := 0.0
+	for _, width := range calibrationWidths {
+		if rate := c.Rates[batchKernel(width)]; rate > best {
+			c.BatchWidth, best = width, rate
+		}
+	}
+	lx.log().Info("calibrated", "kernel", c.Kernel, "batch", batchKernel(c.BatchWidth))
+	return c, nil
+}
+
+// batchKernel names a batch hashing candidate
+func batchKernel(width int) string {
+	return fmt.Sprintf("BatchHasher %d", width)
+}
+
+// NewHasher returns a TunedHasher hashing with lx in the way c found fastest
+func (lx *LXRHash) NewHasher(c Calibration) *TunedHasher {
+	return &TunedHasher{LXRHash: lx, flat: c.Kernel == KernelFlatHash, width: c.BatchWidth}
+}
+
+// TunedHasher hashes with the kernels chosen by a Calibration.  It is safe for concurrent use.
+type TunedHasher struct {
+	*LXRHash
+	flat  bool
+	width int // BatchHasher width
+}
+
+// Hash returns the hash of src, with the faster of Hash and FlatHash
+func (h *TunedHasher) Hash(src []byte) []byte {
+	if h.flat {
+		return h.LXRHash.FlatHash(src)
+	}
+	return h.LXRHash.Hash(src)
+}
+
+// HashParallel returns the hash of base followed by each entry of batch, with a BatchHasher
+// of the fastest width.
+//
+// Panics if the batch has no entries or the ByteMap is not loaded.  Use HashBatch to get an
+// error instead.
+func (h *TunedHasher) HashParallel(base []byte, batch [][]byte) [][]byte {
+	ret, err := h.HashBatch(base, batch)
+	if err != nil {
+		panic(err)
+	}
+	return ret
+}
+
+// HashBatch returns the hash of base followed by each entry of batch, with a BatchHasher of
+// the fastest width
+func (h *TunedHasher) HashBatch(base []byte, batch [][]byte) ([][]byte, error) {
+	return h.LXRHash.hashBatch(base, batch, h.width)
+}
+
+// CalibrationCachePath returns the file caching the calibration of this host for the
+// parameters p, in the user cache directory
+func CalibrationCachePath(p Params) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	host := strings.NewReplacer("/", "_", `\`, "_", ":", "_").Replace(HostID())
+	name := fmt.Sprintf("calibration-%s-seed-%x-passes-%d-size-%d-bits-%d.json",
+		host, p.Seed, p.Passes, p.MapSizeBits, p.HashSize)
+	return filepath.Join(dir, "lxrhash", name), nil
+}
+
+// CalibratedHasher returns a TunedHasher using the fastest kernels for this host.  A calibration
+// cached by an earlier call is used if there is one for this host and parameter set;
+// otherwise Calibrate is run for duration and the result cached.  Failing to read or write
+// the cache is not an error.
+func (lx *LXRHash) CalibratedHasher(ctx context.Context, duration time.Duration) (*TunedHasher, Calibration, error) {
+	path, err := CalibrationCachePath(lx.Params())
+	if err != nil {
+		lx.log().Warn("calibration not cached", "error", err)
+	}
+	if path != "" {
+		if c, err := readCalibration(path); err == nil && c.Host == HostID() && c.Params.ID() == lx.Params().ID() {
+			lx.log().Debug("using cached calibration", "path", path)
+			return lx.NewHasher(c), c, nil
+		}
+	}
+
+	c, err := lx.Calibrate(ctx, duration)
+	if err != nil {
+		return nil, Calibration{}, err
+	}
+	if path != "" {
+		if err := writeCalibration(path, c); err != nil {
+			lx.log().Warn("calibration not cached", "path", path, "error", err)
+		}
+	}
+	return lx.NewHasher(c), c, nil
+}
+
+// readCalibration reads a cached calibration
+func readCalibration(path string) (Calibration, error) {
+	var c Calibration
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(data, &c)
+	return c, err
+}
+
+// writeCalibration caches a calibration
+func writeCalibration(path string, c Calibration) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,119 @@
+package lxr
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCalibrate(t *testing.T) {
+	p := Params{Seed: Seed, MapSizeBits: 12, HashSize: HashSize, Passes: Passes}
+	l, err := New(p, WithEphemeral())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := l.Calibrate(context.Background(), 80*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Rates) != 2+len(calibrationWidths) {
+		t.Errorf("rates: got = %v", c.Rates)
+	}
+	if c.Kernel != KernelHash && c.Kernel != KernelFlatHash {
+		t.Errorf("kernel: got = %q", c.Kernel)
+	}
+	if c.Host != HostID() || c.Params != p {
+		t.Errorf("calibration for: got = %s %v, want = %s %v", c.Host, c.Params, HostID(), p)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := l.Calibrate(ctx, time.Second); err != context.Canceled {
+		t.Errorf("cancelled: got = %v, want = %v", err, context.Canceled)
+	}
+}
+
+func TestNewHasher(t *testing.T) {
+	batch := make([][]byte, 40)
+	for i := range batch {
+		batch[i] = make([]byte, i%5+4)
+		binary.BigEndian.PutUint32(batch[i][i%5:], uint32(i))
+	}
+	for _, c := range []Calibration{
+		{Kernel: KernelHash, BatchWidth: 0},
+		{Kernel: KernelFlatHash, BatchWidth: 16},
+	} {
+		h := lx.NewHasher(c)
+		if got, want := h.Hash(oprhash), lx.Hash(oprhash); !bytes.Equal(got, want) {
+			t.Errorf("%+v: got = %x, want = %x", c, got, want)
+		}
+		results, err := h.HashBatch(oprhash, batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		again := h.HashParallel(oprhash, batch[:1])
+		for i := range batch {
+			want := lx.Hash(append(append([]byte(nil), oprhash...), batch[i]...))
+			if !bytes.Equal(results[i], want) {
+				t.Errorf("%+v, item %d: got = %x, want = %x", c, i, results[i], want)
+			}
+		}
+		if !bytes.Equal(results[0], again[0]) {
+			t.Errorf("%+v: results changed by a later call", c)
+		}
+	}
+}
+
+func TestCalibratedHasher_Cache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lxrcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// the user cache directory is $XDG_CACHE_HOME on Unix, and under $HOME on macOS
+	for _, env := range []string{"XDG_CACHE_HOME", "HOME"} {
+		old, had := os.LookupEnv(env)
+		defer func(env string) {
+			if had {
+				os.Setenv(env, old)
+			} else {
+				os.Unsetenv(env)
+			}
+		}(env)
+		os.Setenv(env, dir)
+	}
+
+	p := Params{Seed: Seed, MapSizeBits: 10, HashSize: HashSize, Passes: Passes}
+	l, err := New(p, WithEphemeral())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, c, err := l.CalibratedHasher(context.Background(), 80*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, err := CalibrationCachePath(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("not cached: %v", err)
+	}
+
+	// a cancelled context shows the cached calibration is used without benchmarking
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, c2, err := l.CalibratedHasher(ctx, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(c, c2) {
+		t.Errorf("cached: got = %+v, want = %+v", c2, c)
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+
+// Command lxrcachesim records the ByteMap reads made while hashing, and replays them through
+// models of the caches and TLBs to see how hashing uses the memory hierarchy.
+//
+//	lxrcachesim record [-ephemeral] [-hashes n] [-o trace] params
+//	lxrcachesim sim [-cache name:size:line:ways]... [-tlb name:size:page:ways]... trace...
+//
+// record hashes n inputs shaped like those of a miner, a 32 byte base and an 8 byte nonce,
+// and writes the access trace.  Params are in the form seed:bits:hashbits:passes.
+//
+// sim reports, for each trace, the distinct lines and pages touched, the distribution of the
+// distance between consecutive reads, and the hit rate of each level of the caches and of the
+// TLBs.  Each cache level sees the reads that missed the level before; the TLBs likewise.  A
+// TLB is given as the bytes it maps, entries times page size, and the page size.  The default
+// models a typical desktop CPU with 4 KiB pages.
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	lxr "github.com/pegnet/LXRHash"
+	"github.com/pegnet/LXRHash/internal/cachesim"
+)
+
+var (
+	defaultCaches = []string{"L1:32K:64:8", "L2:1M:64:16", "L3:32M:64:16"}
+	defaultTLBs   = []string{"DTLB:256K:4K:4", "STLB:6M:4K:12"}
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: lxrcachesim record [-ephemeral] [-hashes n] [-o trace] params")
+	fmt.Fprintln(os.Stderr, "       lxrcachesim sim [-cache name:size:line:ways]... [-tlb name:size:page:ways]... trace...")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	var err error
+	switch os.Args[1] {
+	case "record":
+		err = record(os.Args[2:])
+	case "sim":
+		err = sim(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "lxrcachesim:", err)
+		os.Exit(1)
+	}
+}
+
+func record(args []string) error {
+	fs := flag.NewFlagSet("record", flag.ExitOnError)
+	ephemeral := fs.Bool("ephemeral", false, "generate the table in memory rather than use a table file")
+	hashes := fs.Int("hashes", 100, "number of hashes to record")
+	out := fs.String("o", "", "write the trace to `file` rather than standard output")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		usage()
+	}
+	p, err := lxr.ParseParams(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	var opts []lxr.Option
+	if *ephemeral {
+		opts = append(opts, lxr.WithEphemeral())
+	}
+	lx, err := lxr.New(p, opts...)
+	if err != nil {
+		return err
+	}
+	defer lx.Close()
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	base := sha256.Sum256([]byte(p.String()))
+	input := make([]byte, len(base)+8)
+	copy(input, base[:])
+	rec := lx.NewAccessRecorder(w)
+	for i := 0; i < *hashes; i++ {
+		binary.BigEndian.PutUint64(input[len(base):], uint64(i))
+		rec.Hash(input)
+	}
+	if err := rec.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "recorded %d reads in %d hashes\n", rec.Accesses(), *hashes)
+	return nil
+}
+
+// configs collects repeated cache or TLB flags
+type configs []cachesim.Config
+
+func (c *configs) String() string { return fmt.Sprint(*c) }
+
+func (c *configs) Set(s string) error {
+	conf, err := cachesim.ParseConfig(s)
+	if err != nil {
+		return err
+	}
+	*c = append(*c, conf)
+	return nil
+}
+
+func sim(args []string) error {
+	fs := flag.NewFlagSet("sim", flag.ExitOnError)
+	var caches, tlbs configs
+	fs.Var(&caches, "cache", "cache level `name:size:line:ways`, closest first; may be repeated (default "+
+		strings.Join(defaultCaches, " ")+")")
+	fs.Var(&tlbs, "tlb", "TLB level `name:size:page:ways`, closest first; may be repeated (default "+
+		strings.Join(defaultTLBs, " ")+")")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		usage()
+	}
+	if len(caches) == 0 {
+		for _, s := range defaultCaches {
+			caches.Set(s)
+		}
+	}
+	if len(tlbs) == 0 {
+		for _, s := range defaultTLBs {
+			tlbs.Set(s)
+		}
+	}
+
+	for _, name := range fs.Args() {
+		if err := simFile(name, caches, tlbs); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// simFile replays one trace and prints the report
+func simFile(name string, caches, tlbs []cachesim.Config) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	tr, err := lxr.NewAccessTraceReader(f)
+	if err != nil {
+		return err
+	}
+	ch, err := cachesim.NewHierarchy(caches)
+	if err != nil {
+		return err
+	}
+	th, err := cachesim.NewHierarchy(tlbs)
+	if err != nil {
+		return err
+	}
+
+	a := cachesim.NewAnalysis()
+	memory, walks := uint64(0), uint64(0)
+	for {
+		addr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		a.Add(addr)
+		if ch.Access(addr) == len(ch) {
+			memory++
+		}
+		if th.Access(addr) == len(th) {
+			walks++
+		}
+	}
+	if a.Accesses == 0 {
+		return fmt.Errorf("no reads in the trace")
+	}
+
+	size := uint64(1) << tr.MapSizeBits
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+	fmt.Fprintf(w, "%s: %s table, %d reads\n", name, cachesim.FormatSize(size), a.Accesses)
+	fmt.Fprintf(w, "  %-16s %d of %d (%.1f%%)\n", "lines touched", len(a.Lines), (size+63)/64, percent(uint64(len(a.Lines)), (size+63)/64))
+	fmt.Fprintf(w, "  %-16s %d of %d (%.1f%%)\n", "pages touched", len(a.Pages), (size+4095)/4096, percent(uint64(len(a.Pages)), (size+4095)/4096))
+	fmt.Fprintf(w, "  %-16s", "strides")
+	lower := uint64(0)
+	for i, limit := range cachesim.StrideBuckets {
+		label := "<" + cachesim.FormatSize(limit)
+		if i == len(cachesim.StrideBuckets)-1 {
+			label = ">=" + cachesim.FormatSize(lower)
+		}
+		fmt.Fprintf(w, " %s %.1f%%", label, percent(a.Strides[i], a.Accesses-1))
+		lower = limit
+	}
+	fmt.Fprintln(w)
+	for _, c := range append(ch, th...) {
+		fmt.Fprintf(w, "  %-16s %d accesses, %.1f%% hits\n", c.Config.String(), c.Accesses, 100*c.HitRate())
+	}
+	fmt.Fprintf(w, "  %-16s %.1f%% of reads miss every cache\n", "memory", percent(memory, a.Accesses))
+	fmt.Fprintf(w, "  %-16s %.1f%% of reads miss every TLB\n", "page walks", percent(walks, a.Accesses))
+	return nil
+}
+
+func percent(n, of uint64) float64 {
+	if of == 0 {
+		return 0
+	}
+	return 100 * float64(n) / float64(of)
+}
@@ -0,0 +1,265 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+
+// Command lxrvectors generates LXRHash test vectors, and checks this library or another
+// implementation against them.
+//
+//	lxrvectors generate [-states] [-ephemeral] [-input text]... params... > vectors.json
+//	lxrvectors check [-ephemeral] [-exec command] vectors.json
+//	lxrvectors trace [-ephemeral] [-hex] params input
+//
+// Params are in the form seed:bits:hashbits:passes, e.g. 0xfafaececfafaecec:10:256:5.  generate
+// hashes a standard set of inputs, chosen to cover the wrap around of the input onto the
+// intermediate results, and any given with -input.
+//
+// check uses this library unless -exec is given.  The command is then started once and sent
+// one line per vector on its standard input:
+//
+//	params fingerprint input
+//
+// with the fingerprint and input in hex, and an empty input written as "-".  It must answer
+// each line with the hash in hex on a line of its standard output, flushing it before reading
+// the next line.
+//
+// trace prints every step of hashing input: the state after the step, and each ByteMap read
+// with the line of step.spec making it.  Diff it against a trace from another implementation
+// to find where the two diverge.
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	lxr "github.com/pegnet/LXRHash"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: lxrvectors generate [-states] [-ephemeral] [-input text]... params...")
+	fmt.Fprintln(os.Stderr, "       lxrvectors check [-ephemeral] [-exec command] vectors.json")
+	fmt.Fprintln(os.Stderr, "       lxrvectors trace [-ephemeral] [-hex] params input")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	var err error
+	switch os.Args[1] {
+	case "generate":
+		err = generate(os.Args[2:])
+	case "check":
+		err = check(os.Args[2:])
+	case "trace":
+		err = trace(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "lxrvectors:", err)
+		os.Exit(1)
+	}
+}
+
+// inputs collects the -input flags
+type inputs [][]byte
+
+func (in *inputs) String() string { return fmt.Sprint(len(*in), " inputs") }
+
+func (in *inputs) Set(s string) error {
+	*in = append(*in, []byte(s))
+	return nil
+}
+
+func generate(args []string) error {
+	fs := flag.NewFlagSet("generate", flag.ExitOnError)
+	states := fs.Bool("states", false, "include the intermediate states")
+	ephemeral := fs.Bool("ephemeral", false, "generate tables in memory rather than use table files")
+	var extra inputs
+	fs.Var(&extra, "input", "also hash `text`; may be repeated")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		usage()
+	}
+
+	var vectors []lxr.Vector
+	for _, arg := range fs.Args() {
+		p, err := lxr.ParseParams(arg)
+		if err != nil {
+			return err
+		}
+		var opts []lxr.Option
+		if *ephemeral {
+			opts = append(opts, lxr.WithEphemeral())
+		}
+		lx, err := lxr.New(p, opts...)
+		if err != nil {
+			return err
+		}
+		for _, input := range append(standardInputs(int(lx.HashSize)), extra...) {
+			vectors = append(vectors, lx.Vector(input, *states))
+		}
+		lx.Close()
+	}
+	return lxr.WriteVectors(os.Stdout, vectors)
+}
+
+// standardInputs returns the inputs hashed for every parameter set: the empty input, a few
+// short strings and single bytes, and inputs either side of one and two times the hash size,
+// where the input wraps around onto the intermediate results.
+func standardInputs(hashSize int) [][]byte {
+	in := [][]byte{{}, []byte("abcde"), []byte("foo"), []byte("pegnet"), {0x00}, {0xff}}
+	for _, n := range []int{hashSize - 1, hashSize, hashSize + 1, 2 * hashSize, 2*hashSize + 1} {
+		if n < 2 {
+			continue
+		}
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = byte(i*7 + n)
+		}
+		in = append(in, b)
+	}
+	return in
+}
+
+func check(args []string) error {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	ephemeral := fs.Bool("ephemeral", false, "generate tables in memory rather than use table files")
+	command := fs.String("exec", "", "check `command` rather than this library")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		usage()
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	file, err := lxr.ReadVectors(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("%s: %v", fs.Arg(0), err)
+	}
+
+	var hash func(lxr.Vector) ([]byte, error)
+	if *command != "" {
+		ext, err := startExternal(strings.Fields(*command))
+		if err != nil {
+			return err
+		}
+		defer ext.close()
+		hash = ext.hash
+	} else {
+		var opts []lxr.Option
+		if *ephemeral {
+			opts = append(opts, lxr.WithEphemeral())
+		}
+		hash = lxr.VectorHasher(opts...)
+	}
+
+	failures := lxr.CheckVectors(file.Vectors, hash)
+	for _, failure := range failures {
+		fmt.Println(failure.Error())
+	}
+	fmt.Printf("%d of %d vectors passed\n", len(file.Vectors)-len(failures), len(file.Vectors))
+	if len(failures) > 0 {
+		return errors.New("check failed")
+	}
+	return nil
+}
+
+func trace(args []string) error {
+	fs := flag.NewFlagSet("trace", flag.ExitOnError)
+	ephemeral := fs.Bool("ephemeral", false, "generate the table in memory rather than use a table file")
+	isHex := fs.Bool("hex", false, "the input is in hex")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		usage()
+	}
+	p, err := lxr.ParseParams(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	input := []byte(fs.Arg(1))
+	if *isHex {
+		if input, err = hex.DecodeString(fs.Arg(1)); err != nil {
+			return err
+		}
+	}
+
+	var opts []lxr.Option
+	if *ephemeral {
+		opts = append(opts, lxr.WithEphemeral())
+	}
+	lx, err := lxr.New(p, opts...)
+	if err != nil {
+		return err
+	}
+	defer lx.Close()
+
+	w := bufio.NewWriter(os.Stdout)
+	hash := lx.HashTrace(input, func(st *lxr.TraceStep) {
+		fmt.Fprintln(w, st)
+	})
+	fmt.Fprintf(w, "hash %x\n", hash)
+	return w.Flush()
+}
+
+// external is an implementation under test running in another process
+type external struct {
+	cmd *exec.Cmd
+	in  io.WriteCloser
+	out *bufio.Reader
+}
+
+func startExternal(args []string) (*external, error) {
+	if len(args) == 0 {
+		return nil, errors.New("no command given to -exec")
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stderr = os.Stderr
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &external{cmd: cmd, in: in, out: bufio.NewReader(out)}, nil
+}
+
+// hash sends one vector to the command and reads back its hash
+func (e *external) hash(v lxr.Vector) ([]byte, error) {
+	input := fmt.Sprintf("%x", []byte(v.Input))
+	if input == "" {
+		input = "-"
+	}
+	if _, err := fmt.Fprintf(e.in, "%v %x %s\n", v.Params, []byte(v.Fingerprint), input); err != nil {
+		return nil, err
+	}
+	line, err := e.out.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("reading from command: %v", err)
+	}
+	var out lxr.HexBytes
+	if err := out.UnmarshalText([]byte(strings.TrimSpace(line))); err != nil {
+		return nil, fmt.Errorf("command answered %q: %v", strings.TrimSpace(line), err)
+	}
+	return out, nil
+}
+
+func (e *external) close() {
+	e.in.Close()
+	e.cmd.Wait()
+}
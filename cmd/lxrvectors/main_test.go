@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	lxr "github.com/pegnet/LXRHash"
+)
+
+// helperEnv selects how TestHelperProcess behaves when run as the command under test
+const helperEnv = "LXRVECTORS_HELPER"
+
+// TestHelperProcess is not a test: it is the external implementation started by the tests
+// below.  It parses each line of the protocol strictly and answers with the hash computed
+// by this library, or misbehaves as the test asks.
+func TestHelperProcess(t *testing.T) {
+	mode := os.Getenv(helperEnv)
+	if mode == "" {
+		return
+	}
+	defer os.Exit(0)
+
+	hash := lxr.VectorHasher(lxr.WithEphemeral())
+	sc := bufio.NewScanner(os.Stdin)
+	for sc.Scan() {
+		fields := strings.Split(sc.Text(), " ")
+		if len(fields) != 3 || fields[2] == "" {
+			fmt.Fprintf(os.Stderr, "bad line %q\n", sc.Text())
+			os.Exit(1)
+		}
+		var v lxr.Vector
+		var err error
+		if v.Params, err = lxr.ParseParams(fields[0]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if v.Fingerprint, err = hex.DecodeString(fields[1]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if fields[2] != "-" {
+			if v.Input, err = hex.DecodeString(fields[2]); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+
+		switch mode {
+		case "hash":
+			out, err := hash(v)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			fmt.Printf("%x\n", out)
+		case "garbage":
+			fmt.Println("not hex")
+		case "exit":
+			os.Exit(0)
+		}
+	}
+}
+
+// startHelper starts TestHelperProcess as the external implementation
+func startHelper(t *testing.T, mode string) *external {
+	old, had := os.LookupEnv(helperEnv)
+	os.Setenv(helperEnv, mode)
+	defer func() {
+		if had {
+			os.Setenv(helperEnv, old)
+		} else {
+			os.Unsetenv(helperEnv)
+		}
+	}()
+	ext, err := startExternal([]string{os.Args[0], "-test.run=TestHelperProcess"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ext
+}
+
+// testVectors returns vectors for a small table, including one with an empty input
+func testVectors(t *testing.T) []lxr.Vector {
+	lx, err := lxr.New(lxr.Params{Seed: lxr.Seed, MapSizeBits: 10, HashSize: 256, Passes: lxr.Passes}, lxr.WithEphemeral())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vectors []lxr.Vector
+	for _, input := range [][]byte{{}, []byte("foo"), {0x00, 0xff}} {
+		vectors = append(vectors, lx.Vector(input, false))
+	}
+	return vectors
+}
+
+func TestExternal(t *testing.T) {
+	vectors := testVectors(t)
+	ext := startHelper(t, "hash")
+	defer ext.close()
+	for _, failure := range lxr.CheckVectors(vectors, ext.hash) {
+		t.Error(failure)
+	}
+}
+
+func TestExternal_Errors(t *testing.T) {
+	vectors := testVectors(t)
+	for _, mode := range []string{"garbage", "exit"} {
+		ext := startHelper(t, mode)
+		failures := lxr.CheckVectors(vectors, ext.hash)
+		ext.close()
+		if len(failures) != len(vectors) {
+			t.Fatalf("%s: got %d failures, want %d", mode, len(failures), len(vectors))
+		}
+		for _, f := range failures {
+			if f.Err == nil {
+				t.Errorf("%s: vector %d failed without an error", mode, f.Index)
+			}
+		}
+	}
+
+	for _, args := range [][]string{nil, strings.Fields("  ")} {
+		if _, err := startExternal(args); err == nil {
+			t.Errorf("started an empty command %q", args)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package lxr
+
+import "hash"
+
+// Digest computes the hash of the data written to it, implementing hash.Hash.  The sum is
+// identical to Hash over the same data.
+//
+// LXRHash makes two passes over its input, and the second can only start once the first has
+// seen every byte, so a Digest keeps all the data written since the last Reset.  It does not
+// make hashing large inputs cheaper in memory, but lets LXRHash be used wherever a hash.Hash
+// is expected, such as with io.Copy or io.MultiWriter.
+type Digest struct {
+	lx  *LXRHash
+	buf []byte
+}
+
+var _ hash.Hash = (*Digest)(nil)
+
+// NewDigest returns a Digest hashing with lx
+func (lx *LXRHash) NewDigest() *Digest {
+	return &Digest{lx: lx}
+}
+
+// Write adds p to the data hashed.  It never returns an error.
+func (d *Digest) Write(p []byte) (int, error) {
+	d.buf = append(d.buf, p...)
+	return len(p), nil
+}
+
+// Sum appends the hash of the data written so far to b.  It does not change the state of d.
+func (d *Digest) Sum(b []byte) []byte {
+	return append(b, d.lx.Hash(d.buf)...)
+}
+
+// Reset discards the data written so far
+func (d *Digest) Reset() {
+	d.buf = d.buf[:0]
+}
+
+// Size returns the number of bytes in the hash, HashSize
+func (d *Digest) Size() int {
+	return int(d.lx.HashSize)
+}
+
+// BlockSize returns 1.  LXRHash consumes its input a byte at a time, so writes of any size
+// are equally efficient.
+func (d *Digest) BlockSize() int {
+	return 1
+}
@@ -0,0 +1,46 @@
+package lxr
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestDigest(t *testing.T) {
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+
+	d := lx.NewDigest()
+	if d.Size() != int(lx.HashSize) {
+		t.Errorf("size: got = %d, want = %d", d.Size(), lx.HashSize)
+	}
+	for _, n := range []int{0, 1, 31, 32, 33, 1000} {
+		want := lx.Hash(data[:n])
+
+		d.Reset()
+		for i := 0; i < n; i += 7 {
+			j := i + 7
+			if j > n {
+				j = n
+			}
+			d.Write(data[i:j])
+		}
+		if got := d.Sum(nil); !bytes.Equal(got, want) {
+			t.Errorf("%d bytes: got = %x, want = %x", n, got, want)
+		}
+		// Sum must not change the state
+		if got := d.Sum([]byte{1, 2}); !bytes.Equal(got[:2], []byte{1, 2}) || !bytes.Equal(got[2:], want) {
+			t.Errorf("%d bytes, second sum: got = %x, want = 0102%x", n, got, want)
+		}
+	}
+
+	d.Reset()
+	if _, err := io.Copy(d, bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := d.Sum(nil), lx.Hash(data); !bytes.Equal(got, want) {
+		t.Errorf("io.Copy: got = %x, want = %x", got, want)
+	}
+}
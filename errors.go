@@ -0,0 +1,58 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package lxr
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Error kinds returned by the error-returning API.  Use errors.Is to test for them:
+//
+//	if _, err := lxr.New(p); errors.Is(err, lxr.ErrTableDirUnwritable) { ... }
+var (
+	ErrBadParams           = errors.New("bad params")                 // Params could not be parsed
+	ErrBadMapSize          = errors.New("bad map size")               // MapSizeBits out of range
+	ErrBadHashSize         = errors.New("bad hash size")              // HashSize out of range
+	ErrBadPasses           = errors.New("bad passes")                 // Passes out of range
+	ErrNoTablePath         = errors.New("no table path")              // Table directory could not be determined or does not exist
+	ErrTableNotFound       = errors.New("table not found")            // Table file does not exist and may not be generated
+	ErrTableUnreadable     = errors.New("table unreadable")           // Table file exists but could not be read
+	ErrTableCorrupt        = errors.New("table corrupt")              // Table file does not hold a valid ByteMap
+	ErrTableDirUnwritable  = errors.New("table directory unwritable") // Table file or its directory could not be written
+	ErrFingerprintMismatch = errors.New("table fingerprint mismatch") // ByteMap is not the table expected
+	ErrNoTable             = errors.New("no table")                   // ByteMap is not loaded
+	ErrEmptyBatch          = errors.New("empty batch")                // HashBatch was given no inputs
+)
+
+// TableError records a failure to locate, read or write a ByteMap table.
+// Kind is one of the Err* values above; Err is the underlying cause, if any.
+type TableError struct {
+	Op   string // Operation that failed, e.g. "read" or "write"
+	Path string // File or directory involved
+	Kind error  // One of the Err* kinds
+	Err  error  // Underlying cause, may be nil
+}
+
+func (e *TableError) Error() string {
+	msg := e.Op
+	if e.Path != "" {
+		msg += " " + e.Path
+	}
+	msg += ": " + e.Kind.Error()
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Is reports whether target is the kind of this error, so errors.Is matches both
+// the kind and anything in the chain of the underlying cause.
+func (e *TableError) Is(target error) bool { return target == e.Kind }
+
+// Unwrap returns the underlying cause
+func (e *TableError) Unwrap() error { return e.Err }
+
+func badMapSize(bits uint64) error {
+	return fmt.Errorf("%w: must be between %d and %d bits, was %d", ErrBadMapSize, MinMapSizeBits, MaxMapSizeBits, bits)
+}
@@ -0,0 +1,87 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package lxr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// tableKey identifies a ByteMap.  The hash size does not affect the table.
+type tableKey struct {
+	seed, passes, bits uint64
+}
+
+// knownFingerprints holds the SHA-256 of the ByteMap of well known parameter sets, keyed by
+// seed, passes and map size in bits.  The 30 bit table with the default seed and passes is
+// the one PegNet mines with.
+var knownFingerprints = map[tableKey]string{
+	{Seed, Passes, 8}:  "9855b17b807c041622d0f984b6004da28f0554b574f17de788abaa6a38135483",
+	{Seed, Passes, 9}:  "f20da12d938c0d46813e7b63003b8b0852534516336c123c15e9c30803ea915c",
+	{Seed, Passes, 10}: "c1e50b47f68732bce96e3a01bf53d889071ef31b5732c3f07f460c6aa4adf204",
+	{Seed, Passes, 11}: "2dc2a012b81ae4056a00b51c944f0b1da093bd51a09d38c4f4223e2d6dbbd487",
+	{Seed, Passes, 12}: "6b6690d7d31ae6ac0d8d99dd5ba129a9d885e5c32cd38d698e062f835b6ed6d7",
+	{Seed, Passes, 13}: "ddce0db9ae6d1c28499d5040a68819ab75a40dc3ce3cc08c43ac880c83876b46",
+	{Seed, Passes, 14}: "fd165c4eaffceca276ef62599dbcef25667528899cf268d163fdbfa4c916a576",
+	{Seed, Passes, 15}: "c59ce08a0201d5643d76f295e5ca59bd2378591b7bee236df8fcd6927c832485",
+	{Seed, Passes, 16}: "7f5df9e4cd8216cabbbd73ce203a0073357a3e8941d32e0adbb65bd32b214461",
+	{Seed, Passes, 17}: "007af4fbf089a6f87742583ea02cb968ed49111032f497fae26b3d0b129b4456",
+	{Seed, Passes, 18}: "d6a6c1073c7f6d2f6aecc07794e0ff59239118e4e88d63698922f138a18a9ff8",
+	{Seed, Passes, 19}: "749529594f029b332f20cf71b8253d2eb3d9721e96029c6efa2e1851c5dce092",
+	{Seed, Passes, 20}: "e1369a997f98c3d4dbcf85e0c52b759f7daa57654190665ca62baf05037ea957",
+	{Seed, Passes, 21}: "ba22a4a07814784483ba7d6068271b3ea39f82c2cb8b57304f83a80c18308c4b",
+	{Seed, Passes, 22}: "9abc378313108b7296bc165d99846cd91d444f45b5be91b2f6fd7c609bd44ee6",
+	{Seed, Passes, 23}: "5f6a6fb2b080fedead19ea3681ffddbf17c7e95116f566edb5f88c146a7aaba3",
+	{Seed, Passes, 24}: "7d3c0fcbd14067ef7540bef9d46dd676ee216243f1d5daf2607d855d88f3c968",
+	{Seed, Passes, 25}: "387673fa9a1e7f8ab5cbeee5a2985bc4ee3b70c3fe56212a7f922d8282a009de",
+	{Seed, Passes, 26}: "691cc7be73085a995590a43a1214292a517948e53f57b27737d76005fb2014eb",
+	{Seed, Passes, 27}: "759635aae8955f1941a631dad299aaa26f082a7010f891fb25b773bfd6814fc5",
+	{Seed, Passes, 28}: "eaabc8177dfcb57b951bba8d7b41a808990cf9c70d931c83cc2e391879fc8c7c",
+	{Seed, Passes, 29}: "d08a7d1ed93660bd0346d17557dbe8ac4c499096480c796c93f7c54daf535b29",
+	{Seed, Passes, 30}: "55a02ed711747012e92fe70424ed1904de6af0b8def259cc068616b86684e93f",
+}
+
+// KnownFingerprint returns the SHA-256 of the ByteMap for the parameters p, if p is a well
+// known parameter set.
+func KnownFingerprint(p Params) (fingerprint [sha256.Size]byte, ok bool) {
+	s, ok := knownFingerprints[tableKey{p.Seed, p.Passes, p.MapSizeBits}]
+	if !ok {
+		return fingerprint, false
+	}
+	if _, err := hex.Decode(fingerprint[:], []byte(s)); err != nil {
+		panic(err)
+	}
+	return fingerprint, true
+}
+
+// Fingerprint returns the SHA-256 of the ByteMap.  It is computed once per table loaded or
+// generated, so the ByteMap must not be modified in place.
+func (lx *LXRHash) Fingerprint() [sha256.Size]byte {
+	if !lx.haveChecksum {
+		lx.checksum, lx.haveChecksum = sha256.Sum256(lx.ByteMap), true
+	}
+	return lx.checksum
+}
+
+// verifyFingerprint checks the ByteMap against the fingerprint given by WithFingerprint or,
+// failing that, the known fingerprint for the parameters
+func (lx *LXRHash) verifyFingerprint() error {
+	return lx.checkFingerprint(lx.Fingerprint())
+}
+
+// checkFingerprint checks got, the SHA-256 of a ByteMap for this hash, as verifyFingerprint does
+func (lx *LXRHash) checkFingerprint(got [sha256.Size]byte) error {
+	want, ok := KnownFingerprint(lx.Params())
+	if lx.wantFingerprint != nil {
+		want, ok = *lx.wantFingerprint, true
+	}
+	if !ok {
+		return nil
+	}
+	if got != want {
+		return &TableError{Op: "check", Kind: ErrFingerprintMismatch,
+			Err: fmt.Errorf("fingerprint is %x, want %x", got, want)}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package lxr
+
+import (
+	"crypto/sha256"
+	"errors"
+	"testing"
+)
+
+func TestKnownFingerprint(t *testing.T) {
+	for bits := MinMapSizeBits; bits <= 16; bits++ {
+		p := DefaultParams()
+		p.MapSizeBits = bits
+		want, ok := KnownFingerprint(p)
+		if !ok {
+			t.Fatalf("%d bits: no known fingerprint", bits)
+		}
+		l := new(LXRHash)
+		l.setParams(p)
+		l.GenerateTable()
+		if got := l.Fingerprint(); got != want {
+			t.Errorf("%d bits: got = %x, want = %x", bits, got, want)
+		}
+	}
+
+	p := DefaultParams()
+	p.Seed++
+	if _, ok := KnownFingerprint(p); ok {
+		t.Error("fingerprint for unknown parameters")
+	}
+}
+
+// largestGenerated is the largest table TestKnownFingerprint_Large generates; larger ones
+// take minutes, so are only checked if provisioned
+const largestGenerated = 24
+
+func TestKnownFingerprint_Large(t *testing.T) {
+	if testing.Short() {
+		t.Skip("generates tables of up to 16 MiB")
+	}
+	for bits := uint64(17); bits <= MaxMapSizeBits; bits++ {
+		p := DefaultParams()
+		p.MapSizeBits = bits
+		want, ok := KnownFingerprint(p)
+		if !ok {
+			continue
+		}
+
+		var table []byte
+		if bits <= largestGenerated {
+			l := new(LXRHash)
+			l.setParams(p)
+			l.GenerateTable()
+			table = l.ByteMap
+		} else {
+			// a table provisioned on the search path, such as the 30 bit table the other tests
+			// of this package load
+			l, err := New(p, WithNoGenerate(), WithMmap())
+			if errors.Is(err, ErrTableNotFound) {
+				t.Logf("%d bits: no table provisioned, not checked", bits)
+				continue
+			}
+			if err != nil {
+				t.Errorf("%d bits: %v", bits, err)
+				continue
+			}
+			defer l.Close()
+			table = l.ByteMap
+		}
+		if got := sha256.Sum256(table); got != want {
+			t.Errorf("%d bits: got = %x, want = %x", bits, got, want)
+		}
+	}
+}
+
+func TestFingerprint_Verify(t *testing.T) {
+	p := Params{Seed: Seed, MapSizeBits: 8, HashSize: HashSize, Passes: Passes}
+	l := new(LXRHash)
+	l.setParams(p)
+	l.GenerateTable()
+	if got, want := l.Fingerprint(), sha256.Sum256(l.ByteMap); got != want {
+		t.Errorf("fingerprint: got = %x, want = %x", got, want)
+	}
+
+	table := append([]byte(nil), l.ByteMap...)
+	table[0], table[1] = table[1], table[0]
+	if _, err := NewFromTable(p, table); !errors.Is(err, ErrFingerprintMismatch) {
+		t.Errorf("tampered table: got = %v, want = %v", err, ErrFingerprintMismatch)
+	}
+	if _, err := NewFromTable(p, table, WithFingerprint(sha256.Sum256(table))); err != nil {
+		t.Errorf("explicit fingerprint: %v", err)
+	}
+
+	// unknown parameters are not checked
+	p.Seed++
+	if _, err := NewFromTable(p, table); err != nil {
+		t.Errorf("unknown parameters: %v", err)
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+
+//go:build ignore
+// +build ignore
+
+// gen_kernels generates kernels_gen.go from step.spec and kernels.go.tmpl
+package main
+
+import (
+	"io/ioutil"
+	"log"
+
+	"github.com/pegnet/LXRHash/internal/stepgen"
+)
+
+func main() {
+	src, err := ioutil.ReadFile("step.spec")
+	if err != nil {
+		log.Fatal(err)
+	}
+	spec, err := stepgen.ParseSpec(src)
+	if err != nil {
+		log.Fatal(err)
+	}
+	tmpl, err := ioutil.ReadFile("kernels.go.tmpl")
+	if err != nil {
+		log.Fatal(err)
+	}
+	out, err := stepgen.Generate(spec, tmpl)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile("kernels_gen.go", out, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
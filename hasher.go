@@ -0,0 +1,20 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package lxr
+
+// Hasher hashes inputs with one parameter set.  *LXRHash implements it, as does the
+// TunedHasher returned by NewHasher.  Depend on Hasher rather than LXRHash so tests can use
+// the small and fake hashers of package lxrtest instead of loading a full size table.
+type Hasher interface {
+	// Hash returns the hash of src, HashSize bytes long
+	Hash(src []byte) []byte
+	// HashBatch returns the hash of base followed by each entry of batch
+	HashBatch(base []byte, batch [][]byte) ([][]byte, error)
+	// Params returns the parameters of the hash space
+	Params() Params
+}
+
+var (
+	_ Hasher = (*LXRHash)(nil)
+	_ Hasher = (*TunedHasher)(nil)
+)
@@ -0,0 +1,47 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package cachesim
+
+// StrideBuckets are the upper bounds of the buckets of Analysis.Strides: the distance between
+// consecutive accesses is within a cache line, within a 4 KiB page, within a 2 MiB huge page,
+// or further.
+var StrideBuckets = []uint64{64, 4 << 10, 2 << 20, 1 << 63}
+
+// Analysis summarizes an access trace without reference to any cache
+type Analysis struct {
+	Accesses uint64
+	Lines    map[uint64]struct{} // Distinct 64 byte lines touched
+	Pages    map[uint64]struct{} // Distinct 4 KiB pages touched
+	Strides  []uint64            // Counts of the distance from the previous access, by StrideBuckets
+	last     uint64
+	haveLast bool
+}
+
+// NewAnalysis returns an empty Analysis
+func NewAnalysis() *Analysis {
+	return &Analysis{
+		Lines:   make(map[uint64]struct{}),
+		Pages:   make(map[uint64]struct{}),
+		Strides: make([]uint64, len(StrideBuckets)),
+	}
+}
+
+// Add records one access
+func (a *Analysis) Add(addr uint64) {
+	a.Accesses++
+	a.Lines[addr>>6] = struct{}{}
+	a.Pages[addr>>12] = struct{}{}
+	if a.haveLast {
+		d := addr - a.last
+		if addr < a.last {
+			d = a.last - addr
+		}
+		for i, limit := range StrideBuckets {
+			if d < limit || i == len(StrideBuckets)-1 {
+				a.Strides[i]++
+				break
+			}
+		}
+	}
+	a.last, a.haveLast = addr, true
+}
@@ -0,0 +1,234 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+
+// Package cachesim models caches and TLBs, to replay the ByteMap access traces recorded by
+// lxr.AccessRecorder.  A TLB is modelled as a cache whose lines are pages.  Replacement is
+// least recently used, and the ByteMap is taken to start on a page boundary.
+package cachesim
+
+import (
+	"container/list"
+	"fmt"
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// Config describes one cache or TLB
+type Config struct {
+	Name     string
+	Size     uint64 // Bytes held, or for a TLB the bytes mapped: entries times page size
+	LineSize uint64 // Bytes per line, or for a TLB the page size; a power of two
+	Ways     int    // Associativity; 0 for fully associative
+}
+
+// ParseConfig parses name:size:line:ways, with sizes in bytes or suffixed with K, M or G,
+// e.g. L1:32K:64:8 or STLB:6M:4K:12.  Ways of 0 is fully associative.
+func ParseConfig(s string) (Config, error) {
+	fields := strings.Split(s, ":")
+	if len(fields) != 4 {
+		return Config{}, fmt.Errorf("%q is not of the form name:size:line:ways", s)
+	}
+	c := Config{Name: fields[0]}
+	var err error
+	if c.Size, err = ParseSize(fields[1]); err != nil {
+		return Config{}, fmt.Errorf("%q: %v", s, err)
+	}
+	if c.LineSize, err = ParseSize(fields[2]); err != nil {
+		return Config{}, fmt.Errorf("%q: %v", s, err)
+	}
+	if c.Ways, err = strconv.Atoi(fields[3]); err != nil {
+		return Config{}, fmt.Errorf("%q: %v", s, err)
+	}
+	return c, c.Validate()
+}
+
+// ParseSize parses a size in bytes, optionally suffixed with K, M or G
+func ParseSize(s string) (uint64, error) {
+	text := s
+	shift := uint(0)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		shift = 10
+	case strings.HasSuffix(s, "M"):
+		shift = 20
+	case strings.HasSuffix(s, "G"):
+		shift = 30
+	}
+	if shift > 0 {
+		s = s[:len(s)-1]
+	}
+	v, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if v > math.MaxUint64>>shift {
+		return 0, fmt.Errorf("size %s is too large", text)
+	}
+	return v << shift, nil
+}
+
+// Validate checks that the configuration describes a cache that can be built
+func (c Config) Validate() error {
+	switch {
+	case c.LineSize == 0 || c.LineSize&(c.LineSize-1) != 0:
+		return fmt.Errorf("%s: line size %d is not a power of two", c.Name, c.LineSize)
+	case c.Size < c.LineSize || c.Size%c.LineSize != 0:
+		return fmt.Errorf("%s: size %d is not a multiple of the line size %d", c.Name, c.Size, c.LineSize)
+	case c.Ways < 0:
+		return fmt.Errorf("%s: %d ways", c.Name, c.Ways)
+	case c.Ways > 0 && (c.Size/c.LineSize)%uint64(c.Ways) != 0:
+		return fmt.Errorf("%s: %d lines do not divide into %d ways", c.Name, c.Size/c.LineSize, c.Ways)
+	}
+	return nil
+}
+
+func (c Config) String() string {
+	return fmt.Sprintf("%s:%s:%s:%d", c.Name, FormatSize(c.Size), FormatSize(c.LineSize), c.Ways)
+}
+
+// FormatSize formats a size in bytes as ParseSize accepts it, with the largest exact suffix
+func FormatSize(v uint64) string {
+	for _, s := range []struct {
+		suffix string
+		shift  uint
+	}{{"G", 30}, {"M", 20}, {"K", 10}} {
+		if v >= 1<<s.shift && v%(1<<s.shift) == 0 {
+			return strconv.FormatUint(v>>s.shift, 10) + s.suffix
+		}
+	}
+	return strconv.FormatUint(v, 10)
+}
+
+// Stats counts the accesses to a cache
+type Stats struct {
+	Accesses, Hits uint64
+}
+
+// HitRate returns the fraction of accesses that hit, or 0 if there were none
+func (s Stats) HitRate() float64 {
+	if s.Accesses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Accesses)
+}
+
+// linearWays is the most ways a set is searched line by line; wider sets, such as those of a
+// fully associative cache, are indexed by a map
+const linearWays = 32
+
+// Cache is a set associative cache with LRU replacement
+type Cache struct {
+	Config
+	Stats
+	lineShift uint
+	sets      [][]uint64 // Lines held in each set, most recently used first
+	wide      []wideSet  // Sets of more than linearWays ways, in place of sets
+	ways      int
+}
+
+// New returns an empty cache
+func New(c Config) (*Cache, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	lines := int(c.Size / c.LineSize)
+	ways := c.Ways
+	if ways == 0 {
+		ways = lines
+	}
+	cache := &Cache{
+		Config:    c,
+		lineShift: uint(bits.TrailingZeros64(c.LineSize)),
+		ways:      ways,
+	}
+	if ways > linearWays {
+		cache.wide = make([]wideSet, lines/ways)
+	} else {
+		cache.sets = make([][]uint64, lines/ways)
+	}
+	return cache, nil
+}
+
+// Access looks up the line holding addr, loading it if it is missing, and reports whether
+// it was a hit
+func (c *Cache) Access(addr uint64) bool {
+	c.Accesses++
+	line := addr >> c.lineShift
+	if c.wide != nil {
+		hit := c.wide[line%uint64(len(c.wide))].access(line, c.ways)
+		if hit {
+			c.Hits++
+		}
+		return hit
+	}
+
+	set := c.sets[line%uint64(len(c.sets))]
+	for i, l := range set {
+		if l == line {
+			copy(set[1:i+1], set[:i])
+			set[0] = line
+			c.Hits++
+			return true
+		}
+	}
+	if len(set) < c.ways {
+		set = append(set, 0)
+	}
+	copy(set[1:], set)
+	set[0] = line
+	c.sets[line%uint64(len(c.sets))] = set
+	return false
+}
+
+// wideSet is a set of many ways: a list of lines, most recently used first, and a map from
+// each line to its element of the list
+type wideSet struct {
+	order *list.List
+	lines map[uint64]*list.Element
+}
+
+// access looks up line, loading it if it is missing and evicting the least recently used of
+// ways lines if the set is full, and reports whether it was a hit
+func (s *wideSet) access(line uint64, ways int) bool {
+	if s.order == nil {
+		s.order, s.lines = list.New(), make(map[uint64]*list.Element)
+	}
+	if e, ok := s.lines[line]; ok {
+		s.order.MoveToFront(e)
+		return true
+	}
+	if s.order.Len() >= ways {
+		delete(s.lines, s.order.Remove(s.order.Back()).(uint64))
+	}
+	s.lines[line] = s.order.PushFront(line)
+	return false
+}
+
+// Hierarchy is a list of caches, each seeing the accesses that missed in the one before
+type Hierarchy []*Cache
+
+// NewHierarchy returns empty caches for the configurations, from the closest to the furthest
+func NewHierarchy(configs []Config) (Hierarchy, error) {
+	var h Hierarchy
+	for _, c := range configs {
+		cache, err := New(c)
+		if err != nil {
+			return nil, err
+		}
+		h = append(h, cache)
+	}
+	return h, nil
+}
+
+// Access looks up addr in each level until it hits, and returns the level that hit, or
+// len(h) if every level missed
+func (h Hierarchy) Access(addr uint64) int {
+	for i, c := range h {
+		if c.Access(addr) {
+			return i
+		}
+	}
+	return len(h)
+}
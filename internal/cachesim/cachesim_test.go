@@ -0,0 +1,143 @@
+package cachesim
+
+import "testing"
+
+func TestParseConfig(t *testing.T) {
+	c, err := ParseConfig("STLB:6M:4K:12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Name != "STLB" || c.Size != 6<<20 || c.LineSize != 4<<10 || c.Ways != 12 {
+		t.Errorf("got = %+v", c)
+	}
+	if c.String() != "STLB:6M:4K:12" {
+		t.Errorf("String: got = %s", c)
+	}
+	for _, bad := range []string{"L1:32K:64", "L1:32K:48:8", "L1:32:64:1", "L1:32K:64:7", "L1:32X:64:8"} {
+		if _, err := ParseConfig(bad); err == nil {
+			t.Errorf("%s: accepted", bad)
+		}
+	}
+}
+
+func TestCache(t *testing.T) {
+	// Two sets of two lines of 64 bytes
+	c, err := New(Config{Name: "test", Size: 256, LineSize: 64, Ways: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps := []struct {
+		addr uint64
+		hit  bool
+	}{
+		{0, false},
+		{63, true},   // same line
+		{64, false},  // other set
+		{128, false}, // set 0 now full
+		{0, true},    // 0 becomes most recently used
+		{256, false}, // evicts 128
+		{128, false},
+		{0, false}, // evicted by 128
+		{64, true},
+	}
+	for i, s := range steps {
+		if hit := c.Access(s.addr); hit != s.hit {
+			t.Errorf("access %d at %d: hit = %v, want %v", i, s.addr, hit, s.hit)
+		}
+	}
+	if c.Accesses != uint64(len(steps)) || c.Hits != 3 {
+		t.Errorf("stats: got = %+v", c.Stats)
+	}
+	if r := c.HitRate(); r != 3.0/9 {
+		t.Errorf("hit rate: got = %v", r)
+	}
+}
+
+func TestCache_Wide(t *testing.T) {
+	// Fully associative, and 64 ways, are indexed rather than searched
+	for _, ways := range []int{0, 64} {
+		lines := 128
+		c, err := New(Config{Name: "wide", Size: uint64(lines) * 64, LineSize: 64, Ways: ways})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sets := 1
+		if ways > 0 {
+			sets = lines / ways
+		}
+		perSet := lines / sets
+
+		// fill every set, touch all but the first line of each again, then overflow each set
+		for i := 0; i < lines; i++ {
+			if c.Access(uint64(i) * 64) {
+				t.Fatalf("%d ways: cold access %d hit", ways, i)
+			}
+		}
+		for i := sets; i < lines; i++ {
+			if !c.Access(uint64(i) * 64) {
+				t.Fatalf("%d ways: warm access %d missed", ways, i)
+			}
+		}
+		for i := lines; i < lines+sets; i++ {
+			c.Access(uint64(i) * 64)
+		}
+		// the least recently used line of each set was evicted, and only that
+		for i := 0; i < sets; i++ {
+			if c.Access(uint64(i) * 64) {
+				t.Errorf("%d ways: line %d not evicted", ways, i)
+			}
+		}
+		if !c.Access(uint64(lines-1) * 64) {
+			t.Errorf("%d ways: recently used line evicted", ways)
+		}
+		if c.wide == nil || perSet != c.ways {
+			t.Errorf("%d ways: %d ways per set, wide = %v", ways, c.ways, c.wide != nil)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	for s, want := range map[string]uint64{"64": 64, "4K": 4 << 10, "6M": 6 << 20, "16G": 16 << 30} {
+		if got, err := ParseSize(s); err != nil || got != want {
+			t.Errorf("%s: got = %d, %v, want = %d", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "K", "-1", "17179869184G", "18446744073709551616"} {
+		if _, err := ParseSize(s); err == nil {
+			t.Errorf("%s: accepted", s)
+		}
+	}
+}
+
+func TestHierarchy(t *testing.T) {
+	h, err := NewHierarchy([]Config{{Name: "L1", Size: 64, LineSize: 64}, {Name: "L2", Size: 128, LineSize: 64}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []int{2, 0, 2, 1, 1} {
+		addr := []uint64{0, 0, 64, 0, 64}[i]
+		if got := h.Access(addr); got != want {
+			t.Errorf("access %d at %d: hit in level %d, want %d", i, addr, got, want)
+		}
+	}
+	if h[1].Accesses != 4 {
+		t.Errorf("L2 saw %d accesses, want 4", h[1].Accesses)
+	}
+}
+
+func TestAnalysis(t *testing.T) {
+	a := NewAnalysis()
+	for _, addr := range []uint64{0, 10, 5000, 100, 3 << 20} {
+		a.Add(addr)
+	}
+	if a.Accesses != 5 || len(a.Lines) != 4 || len(a.Pages) != 3 {
+		t.Errorf("got %d accesses, %d lines, %d pages", a.Accesses, len(a.Lines), len(a.Pages))
+	}
+	want := []uint64{1, 0, 2, 1}
+	for i := range want {
+		if a.Strides[i] != want[i] {
+			t.Errorf("strides: got = %v, want = %v", a.Strides, want)
+			break
+		}
+	}
+}
@@ -0,0 +1,281 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+
+// Package stepgen generates the LXRHash kernels from the spec of the round in step.spec, so
+// the round is written down once however many ways it is implemented.
+//
+// The template is Go source in text/template form.  {{round "step" "flat"}} expands to the
+// round named step in the style of the flat kernel.  The styles are
+//
+//	closure   state in local variables, B a closure over the ByteMap (Hash)
+//	flat      state in local variables, the ByteMap indexed directly (FlatHash)
+//	batch     state in arrays indexed by lane k, one loop per ByteMap read (BatchHasher)
+//	trace     as closure, B also given the spec line of the read, and set called with the
+//	          value assigned by every line that reads the ByteMap (HashTrace)
+//
+// The batch style takes further arguments, which are statements run at the top of the
+// first loop.
+package stepgen
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/format"
+	"strings"
+	"text/template"
+)
+
+// line is one line of a round
+type line struct {
+	lhs, op, rhs string // Assignment; lhs is "" for a comment or blank line
+	rotate       bool   // Roll s1, s2 and s3 along
+	comment      string // Trailing comment, or the whole line
+	blank        bool
+	n            int // Line number in the spec
+}
+
+// Spec holds the rounds of a spec, by name
+type Spec map[string][]line
+
+// state are the variables held per hash; hs is handled separately
+var state = map[string]bool{"as": true, "s1": true, "s2": true, "s3": true, "v2": true}
+
+// ParseSpec parses a spec.  Lines starting with # are ignored; "name:" starts a round.
+func ParseSpec(src []byte) (Spec, error) {
+	spec := make(Spec)
+	var round string
+	sc := bufio.NewScanner(bytes.NewReader(src))
+	for n := 1; sc.Scan(); n++ {
+		text := strings.TrimSpace(sc.Text())
+		switch {
+		case strings.HasPrefix(text, "#"):
+			continue
+		case strings.HasSuffix(text, ":") && !strings.ContainsAny(text, " =/"):
+			round = strings.TrimSuffix(text, ":")
+			spec[round] = nil
+			continue
+		case round == "":
+			if text == "" {
+				continue
+			}
+			return nil, fmt.Errorf("line %d: %q is outside a round", n, text)
+		}
+
+		l := line{n: n}
+		if i := strings.Index(text, "//"); i >= 0 {
+			l.comment = strings.TrimSpace(text[i+2:])
+			text = strings.TrimSpace(text[:i])
+			if l.comment == "" {
+				l.comment = " " // keep an empty comment
+			}
+		}
+		switch {
+		case text == "" && l.comment == "":
+			l.blank = true
+		case text == "":
+		case text == "rotate":
+			l.rotate = true
+		default:
+			for _, op := range []string{":=", "="} {
+				if i := strings.Index(text, op); i > 0 {
+					l.lhs, l.op, l.rhs = strings.TrimSpace(text[:i]), op, strings.TrimSpace(text[i+len(op):])
+					break
+				}
+			}
+			if l.lhs == "" {
+				return nil, fmt.Errorf("line %d: %q is not an assignment", n, text)
+			}
+		}
+		spec[round] = append(spec[round], l)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	// drop trailing blank lines
+	for name, lines := range spec {
+		for len(lines) > 0 && lines[len(lines)-1].blank {
+			lines = lines[:len(lines)-1]
+		}
+		spec[name] = lines
+	}
+	return spec, nil
+}
+
+// Generate executes the template tmpl with the rounds of spec and formats the result
+func Generate(spec Spec, tmpl []byte) ([]byte, error) {
+	t, err := template.New("kernels").Funcs(template.FuncMap{
+		"round": func(name, style string, prologue ...string) (string, error) {
+			lines, ok := spec[name]
+			if !ok {
+				return "", fmt.Errorf("no round %q", name)
+			}
+			out, err := render(lines, style, prologue)
+			return strings.TrimRight(out, "\n"), err
+		},
+	}).Parse(string(tmpl))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, nil); err != nil {
+		return nil, err
+	}
+	out, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("%v\n%s", err, buf.Bytes())
+	}
+	return out, nil
+}
+
+// render writes the round in the given style
+func render(lines []line, style string, prologue []string) (string, error) {
+	var names func(string) string
+	var b func(string) string
+	switch style {
+	case "closure", "flat", "trace":
+		names = func(v string) string {
+			if v == "hs" {
+				return "hs[idx]"
+			}
+			return v
+		}
+	case "batch":
+		names = func(v string) string {
+			if v == "hs" || state[v] {
+				return v + "[k]"
+			}
+			return v
+		}
+	default:
+		return "", fmt.Errorf("no style %q", style)
+	}
+	b = func(x string) string { return "B(" + x + ")" }
+	if style == "flat" {
+		b = func(x string) string { return "uint64(lx.ByteMap[(" + x + ")&mk])" }
+	}
+
+	var sb strings.Builder
+	if style == "trace" {
+		for _, l := range lines {
+			switch {
+			case l.rotate:
+				sb.WriteString("s1, s2, s3 = s3, s1, s2\n")
+			case l.lhs != "":
+				n := l.n
+				rhs, err := rewrite(l.rhs, names, func(x string) string { return fmt.Sprintf("B(%s, %d)", x, n) })
+				if err != nil {
+					return "", err
+				}
+				fmt.Fprintf(&sb, "%s %s %s\n", names(l.lhs), l.op, rhs)
+				if strings.Contains(l.rhs, "B(") {
+					fmt.Fprintf(&sb, "set(%s)\n", names(l.lhs))
+				}
+			}
+		}
+		return sb.String(), nil
+	}
+	if style == "closure" || style == "flat" {
+		for _, l := range lines {
+			switch {
+			case l.blank:
+				sb.WriteString("\n")
+				continue
+			case l.rotate:
+				sb.WriteString("s1, s2, s3 = s3, s1, s2")
+			case l.lhs == "":
+				sb.WriteString("_ = 0")
+			default:
+				rhs, err := rewrite(l.rhs, names, b)
+				if err != nil {
+					return "", err
+				}
+				fmt.Fprintf(&sb, "%s %s %s", names(l.lhs), l.op, rhs)
+			}
+			if l.comment != "" {
+				sb.WriteString(strings.TrimRight(" // "+strings.TrimSpace(l.comment), " "))
+			}
+			sb.WriteString("\n")
+		}
+		return sb.String(), nil
+	}
+
+	// Batch style: a new loop for every line that reads the ByteMap
+	loop := "for k := range as {\n"
+	open := false
+	for _, l := range lines {
+		if l.blank || (l.lhs == "" && !l.rotate) {
+			continue
+		}
+		if !open || strings.Contains(l.rhs, "B(") {
+			if open {
+				sb.WriteString("}\n")
+			}
+			sb.WriteString(loop)
+			if !open {
+				for _, p := range prologue {
+					sb.WriteString(p + "\n")
+				}
+			}
+			open = true
+		}
+		if l.rotate {
+			sb.WriteString(names("s1") + ", " + names("s2") + ", " + names("s3") + " = " +
+				names("s3") + ", " + names("s1") + ", " + names("s2") + "\n")
+			continue
+		}
+		rhs, err := rewrite(l.rhs, names, b)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&sb, "%s %s %s\n", names(l.lhs), l.op, rhs)
+	}
+	if open {
+		sb.WriteString("}\n")
+	}
+	return sb.String(), nil
+}
+
+// rewrite renames the variables of expr and expands its ByteMap reads
+func rewrite(expr string, names func(string) string, b func(string) string) (string, error) {
+	var sb strings.Builder
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == 'B' && i+1 < len(expr) && expr[i+1] == '(':
+			depth, j := 1, i+2
+			for ; j < len(expr) && depth > 0; j++ {
+				switch expr[j] {
+				case '(':
+					depth++
+				case ')':
+					depth--
+				}
+			}
+			if depth != 0 {
+				return "", fmt.Errorf("unbalanced parentheses in %q", expr)
+			}
+			inner, err := rewrite(expr[i+2:j-1], names, b)
+			if err != nil {
+				return "", err
+			}
+			sb.WriteString(b(inner))
+			i = j
+		case isLetter(c):
+			j := i
+			for j < len(expr) && (isLetter(expr[j]) || expr[j] >= '0' && expr[j] <= '9') {
+				j++
+			}
+			sb.WriteString(names(expr[i:j]))
+			i = j
+		default:
+			sb.WriteByte(c)
+			i++
+		}
+	}
+	return sb.String(), nil
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
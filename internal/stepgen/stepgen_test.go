@@ -0,0 +1,73 @@
+package stepgen
+
+import (
+	"strings"
+	"testing"
+)
+
+const testSpec = `# a comment
+r:
+x := B(as ^ v2) // first
+//                 aside
+hs = s1 ^ B(hs>>3)
+
+s2 = s2 ^ x
+rotate
+`
+
+func TestParseSpec(t *testing.T) {
+	spec, err := ParseSpec([]byte(testSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := spec["r"]
+	if len(lines) != 6 {
+		t.Fatalf("lines: got = %d, want = 6", len(lines))
+	}
+	if l := lines[0]; l.lhs != "x" || l.op != ":=" || l.rhs != "B(as ^ v2)" || l.comment != "first" {
+		t.Errorf("assignment: got = %+v", l)
+	}
+	if l := lines[1]; l.lhs != "" || l.comment != "aside" {
+		t.Errorf("comment: got = %+v", l)
+	}
+	if !lines[3].blank || !lines[5].rotate {
+		t.Errorf("blank and rotate: got = %+v, %+v", lines[3], lines[5])
+	}
+
+	if _, err := ParseSpec([]byte("x = 1\n")); err == nil {
+		t.Error("line outside a round accepted")
+	}
+	if _, err := ParseSpec([]byte("r:\nx + 1\n")); err == nil {
+		t.Error("line that is not an assignment accepted")
+	}
+}
+
+func TestRender(t *testing.T) {
+	spec, err := ParseSpec([]byte(testSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		style string
+		want  []string
+	}{
+		{"closure", []string{"x := B(as ^ v2) // first", "_ = 0 // aside", "hs[idx] = s1 ^ B(hs[idx]>>3)", "s1, s2, s3 = s3, s1, s2"}},
+		{"flat", []string{"x := uint64(lx.ByteMap[(as ^ v2)&mk])", "hs[idx] = s1 ^ uint64(lx.ByteMap[(hs[idx]>>3)&mk])"}},
+		{"trace", []string{"x := B(as ^ v2, 3)\nset(x)\nhs[idx] = s1 ^ B(hs[idx]>>3, 5)\nset(hs[idx])\ns2 = s2 ^ x\ns1, s2, s3 = s3, s1, s2\n"}},
+		{"batch", []string{"for k := range as {\nx := B(as[k] ^ v2[k])\n}", "s1[k], s2[k], s3[k] = s3[k], s1[k], s2[k]\n}"}},
+	}
+	for _, tt := range tests {
+		got, err := render(spec["r"], tt.style, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(got, want) {
+				t.Errorf("%s: %q not in\n%s", tt.style, want, got)
+			}
+		}
+	}
+	if _, err := render(spec["r"], "nonsense", nil); err == nil {
+		t.Error("unknown style accepted")
+	}
+}
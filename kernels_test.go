@@ -0,0 +1,36 @@
+package lxr
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/pegnet/LXRHash/internal/stepgen"
+)
+
+// The kernels must be regenerated, with go generate, whenever step.spec or the template change
+func TestKernelsGenerated(t *testing.T) {
+	src, err := ioutil.ReadFile("step.spec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec, err := stepgen.ParseSpec(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl, err := ioutil.ReadFile("kernels.go.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := stepgen.Generate(spec, tmpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile("kernels_gen.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("kernels_gen.go is out of date; run go generate")
+	}
+}
@@ -0,0 +1,19 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package lxr
+
+import "os"
+
+// Without advisory locks, processes starting together may each generate the table.
+// Writes are still atomic, so none of them can read a partial table.
+const fileLockSupported = false
+
+func tryLockFile(f *os.File) (bool, error) { return true, nil }
+
+func unlockFile(f *os.File) error { return nil }
+
+func syncDir(dir string) error { return nil }
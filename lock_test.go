@@ -0,0 +1,106 @@
+package lxr
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReadTable_WaitsForLock(t *testing.T) {
+	if !fileLockSupported {
+		t.Skip("no advisory file locks on this platform")
+	}
+	dir, err := ioutil.TempDir("", "lxrtables")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a seed with no known fingerprint, so the altered table below is accepted
+	p := Params{Seed: Seed + 1, MapSizeBits: 12, HashSize: HashSize, Passes: Passes}
+	name := filepath.Join(dir, p.TableFilename())
+
+	// pretend to be another process generating the table
+	gen := new(LXRHash)
+	gen.setParams(p)
+	unlock, err := gen.lockTableFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan *LXRHash)
+	go func() {
+		l, err := NewFromPath(p, dir)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- l
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("table loaded while another process holds the lock")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// write a table that differs from the generated one, so we can tell it was read
+	gen.GenerateTable()
+	gen.ByteMap[0], gen.ByteMap[1] = gen.ByteMap[1], gen.ByteMap[0]
+	if err := gen.SaveTable(name); err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+
+	l := <-done
+	if l == nil {
+		t.FailNow()
+	}
+	if !bytes.Equal(l.ByteMap, gen.ByteMap) {
+		t.Errorf("waiting process generated the table instead of reading it")
+	}
+}
+
+func TestReadTable_Concurrent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lxrtables")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := Params{Seed: Seed, MapSizeBits: 16, HashSize: HashSize, Passes: Passes}
+	results := make([]*LXRHash, 8)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			l, err := NewFromPath(p, dir)
+			if err != nil {
+				t.Error(err)
+			}
+			results[i] = l
+		}(i)
+	}
+	wg.Wait()
+
+	for i, l := range results {
+		if l == nil || !bytes.Equal(l.ByteMap, results[0].ByteMap) {
+			t.Errorf("instance %d has a different table", i)
+		}
+	}
+
+	// only the table and its lock file are left behind
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		if f.Name() != p.TableFilename() && f.Name() != p.TableFilename()+".lock" {
+			t.Errorf("unexpected file %s", f.Name())
+		}
+	}
+}
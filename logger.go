@@ -0,0 +1,89 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package lxr
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Logger receives leveled, structured events about loading, generating and writing tables.
+// Args are alternating keys and values, as for log/slog, and a *slog.Logger can be used
+// directly.
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+var (
+	loggerMtx     sync.RWMutex
+	packageLogger Logger
+)
+
+// SetLogger sets the logger used by every LXRHash that has no logger of its own and is not
+// verbose.  A nil logger discards events, which is the default.
+func SetLogger(l Logger) {
+	loggerMtx.Lock()
+	defer loggerMtx.Unlock()
+	packageLogger = l
+}
+
+// SetLogger sets the logger for this instance.  A nil logger falls back to Verbose, then
+// to the package logger set by SetLogger.
+func (lx *LXRHash) SetLogger(l Logger) {
+	lx.logger = l
+}
+
+// WithLogger sets the logger for the instance, see SetLogger
+func WithLogger(l Logger) Option {
+	return func(lx *LXRHash) { lx.logger = l }
+}
+
+// log returns the logger for the instance
+func (lx *LXRHash) log() Logger {
+	if lx.logger != nil {
+		return lx.logger
+	}
+	if lx.verbose {
+		return stdoutLogger{}
+	}
+	loggerMtx.RLock()
+	defer loggerMtx.RUnlock()
+	if packageLogger != nil {
+		return packageLogger
+	}
+	return nopLogger{}
+}
+
+// stdoutLogger prints every event on a line of its own on stdout, as Verbose always has
+type stdoutLogger struct{}
+
+func (stdoutLogger) Debug(msg string, args ...interface{}) { fmt.Println(formatEvent(msg, args)) }
+func (stdoutLogger) Info(msg string, args ...interface{})  { fmt.Println(formatEvent(msg, args)) }
+func (stdoutLogger) Warn(msg string, args ...interface{})  { fmt.Println(formatEvent(msg, args)) }
+func (stdoutLogger) Error(msg string, args ...interface{}) { fmt.Println(formatEvent(msg, args)) }
+
+// formatEvent renders msg followed by key=value pairs
+func formatEvent(msg string, args []interface{}) string {
+	var sb strings.Builder
+	sb.WriteString(msg)
+	for i := 0; i < len(args); i += 2 {
+		if i+1 < len(args) {
+			fmt.Fprintf(&sb, " %v=%v", args[i], args[i+1])
+		} else {
+			fmt.Fprintf(&sb, " %v", args[i])
+		}
+	}
+	return sb.String()
+}
+
+// nopLogger discards every event
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Warn(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
@@ -0,0 +1,9 @@
+//go:build go1.21
+// +build go1.21
+
+package lxr
+
+import "log/slog"
+
+// A *slog.Logger can be used as a Logger
+var _ Logger = (*slog.Logger)(nil)
@@ -0,0 +1,126 @@
+package lxr
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+)
+
+// recordLogger records every event as level, message and arguments
+type recordLogger struct {
+	mtx    sync.Mutex
+	events []string
+}
+
+func (r *recordLogger) record(level, msg string, args []interface{}) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.events = append(r.events, level+" "+formatEvent(msg, args))
+}
+
+func (r *recordLogger) Debug(msg string, args ...interface{}) { r.record("DEBUG", msg, args) }
+func (r *recordLogger) Info(msg string, args ...interface{})  { r.record("INFO", msg, args) }
+func (r *recordLogger) Warn(msg string, args ...interface{})  { r.record("WARN", msg, args) }
+func (r *recordLogger) Error(msg string, args ...interface{}) { r.record("ERROR", msg, args) }
+
+func (r *recordLogger) has(event string) bool {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	for _, e := range r.events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func TestLogger(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lxrtables")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := Params{Seed: Seed, MapSizeBits: 8, HashSize: HashSize, Passes: Passes}
+	name := dir + "/" + p.TableFilename()
+
+	var own, pkg recordLogger
+	SetLogger(&pkg)
+	defer SetLogger(nil)
+
+	if _, err := NewFromPath(p, dir, WithLogger(&own)); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []string{
+		"INFO reading table path=" + name,
+		fmt.Sprintf("INFO generating table path=%s bits=8 passes=5", name),
+		"INFO writing table path=" + name,
+	} {
+		if !own.has(e) {
+			t.Errorf("missing event %q in %q", e, own.events)
+		}
+	}
+	if len(pkg.events) != 0 {
+		t.Errorf("package logger used despite an instance logger: %q", pkg.events)
+	}
+
+	if _, err := NewFromPath(p, dir); err != nil {
+		t.Fatal(err)
+	}
+	if !pkg.has("INFO reading table path=" + name) {
+		t.Errorf("package logger not used: %q", pkg.events)
+	}
+
+	// an instance is silent unless asked otherwise
+	SetLogger(nil)
+	l := new(LXRHash)
+	if _, ok := l.log().(nopLogger); !ok {
+		t.Errorf("default logger is %T", l.log())
+	}
+	l.Verbose(true)
+	if _, ok := l.log().(stdoutLogger); !ok {
+		t.Errorf("verbose logger is %T", l.log())
+	}
+}
+
+func TestLogger_Shared(t *testing.T) {
+	// A parameter set no other test shares, so the instance is created here
+	p := Params{Seed: Seed, MapSizeBits: 11, HashSize: HashSize, Passes: Passes}
+
+	// the shared instance prints nothing
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	shared := Init(p.Seed, p.MapSizeBits, p.HashSize, p.Passes)
+	os.Stdout = stdout
+	w.Close()
+	printed, _ := ioutil.ReadAll(r)
+	if len(printed) != 0 {
+		t.Errorf("shared instance printed %q", printed)
+	}
+	if _, ok := shared.log().(nopLogger); !ok {
+		t.Errorf("shared instance logger is %T", shared.log())
+	}
+	Release(shared)
+
+	// and logs to the package logger
+	var pkg recordLogger
+	SetLogger(&pkg)
+	defer SetLogger(nil)
+	shared = Init(p.Seed, p.MapSizeBits, p.HashSize, p.Passes)
+	defer Release(shared)
+	if len(pkg.events) == 0 {
+		t.Errorf("shared instance did not use the package logger")
+	}
+}
+
+func TestFormatEvent(t *testing.T) {
+	if got := formatEvent("msg", []interface{}{"a", 1, "b", "x", "odd"}); got != "msg a=1 b=x odd" {
+		t.Errorf("got %q", got)
+	}
+}
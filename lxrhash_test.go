@@ -6,8 +6,10 @@ import (
 	"bytes"
 	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"math/rand"
 	"testing"
+	"time"
 )
 
 var lx LXRHash
@@ -74,6 +76,90 @@ func BenchmarkHash(b *testing.B) {
 	b.Run("hash again", normalHash)
 	b.Run("flat hash again", flatHash)
 	b.Run("HashParallel again", batchHash)
+
+	// Reusing the buffers should not allocate at all
+	hashInto := func(b *testing.B) {
+		b.ReportAllocs()
+		no := append([]byte(nil), oprhash...)
+		dst := make([]byte, lx.HashSize)
+		for i := 0; i < b.N; i++ {
+			binary.BigEndian.PutUint32(no[len(no)-4:], uint32(i))
+			lx.HashInto(dst, no)
+		}
+	}
+
+	hashPrefixed := func(b *testing.B) {
+		b.ReportAllocs()
+		nonce := make([]byte, 0, 8)
+		dst := make([]byte, lx.HashSize)
+		for i := 0; i < b.N; i++ {
+			nonce = nonce[:0]
+			for j := i; j > 0; j = j >> 8 {
+				nonce = append(nonce, byte(j))
+			}
+			lx.HashPrefixed(dst, oprhash, nonce)
+		}
+	}
+
+	b.Run("HashInto", hashInto)
+	b.Run("HashPrefixed", hashPrefixed)
+
+	// b.N hashes in batches of 128, interleaving width hashes at a time
+	batchHasher := func(width int) func(b *testing.B) {
+		return func(b *testing.B) {
+			b.ReportAllocs()
+			bh := lx.NewBatchHasher(width)
+			batch := make([][]byte, 128)
+			for i := range batch {
+				batch[i] = make([]byte, 4)
+			}
+			for i := 0; i < b.N; i += len(batch) {
+				for j := range batch {
+					binary.BigEndian.PutUint32(batch[j], uint32(i+j))
+				}
+				if _, err := bh.Hash(oprhash, batch); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	}
+
+	b.Run("BatchHasher 4", batchHasher(4))
+	b.Run("BatchHasher 16", batchHasher(16))
+	b.Run("BatchHasher 32", batchHasher(32))
+	b.Run("BatchHasher 64", batchHasher(64))
+
+	// Compare hashes per second with the table in huge pages and locked in RAM.  Each
+	// runs with its own copy of the table, loaded from disk.
+	memoryHash := func(opts ...Option) func(b *testing.B) {
+		return func(b *testing.B) {
+			l, err := New(lx.Params(), opts...)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer l.Close()
+			b.Logf("%+v", l.Memory())
+
+			nonce := []byte{0, 0}
+			b.ResetTimer()
+			start := time.Now()
+			for i := 0; i < b.N; i++ {
+				nonce = nonce[:0]
+				for j := i; j > 0; j = j >> 8 {
+					nonce = append(nonce, byte(j))
+				}
+				no := append(oprhash, nonce...)
+				l.Hash(no)
+			}
+			b.ReportMetric(float64(b.N)/time.Since(start).Seconds(), "hps")
+		}
+	}
+
+	b.Run("hash heap", memoryHash())
+	b.Run("hash off heap", memoryHash(WithOffHeap()))
+	b.Run("hash transparent huge pages", memoryHash(WithTransparentHugePages()))
+	b.Run("hash hugetlb", memoryHash(WithHugeTLB()))
+	b.Run("hash huge pages mlock", memoryHash(WithTransparentHugePages(), WithMlock()))
 }
 
 func TestKnownHashes(t *testing.T) {
@@ -161,6 +247,31 @@ func TestLXRHash_Hash(t *testing.T) {
 	}
 }
 
+func TestHashPrefixed(t *testing.T) {
+	dst := make([]byte, lx.HashSize)
+	for i := 0; i < 100; i++ {
+		base := make([]byte, rand.Intn(100))
+		nonce := make([]byte, rand.Intn(10))
+		rand.Read(base)
+		rand.Read(nonce)
+		want := lx.Hash(append(append([]byte(nil), base...), nonce...))
+		if got := lx.HashPrefixed(dst, base, nonce); !bytes.Equal(got, want) {
+			t.Errorf("HashPrefixed mismatch\n%x\n%x", got, want)
+		}
+		if got := lx.HashInto(dst, base); !bytes.Equal(got, lx.Hash(base)) {
+			t.Errorf("HashInto mismatch\n%x\n%x", got, lx.Hash(base))
+		}
+	}
+
+	nonce := []byte{1, 2, 3, 4}
+	allocs := testing.AllocsPerRun(100, func() {
+		lx.HashPrefixed(dst, oprhash, nonce)
+	})
+	if allocs != 0 {
+		t.Errorf("HashPrefixed allocates: %v allocs/op", allocs)
+	}
+}
+
 func TestBatch(t *testing.T) {
 	batchsize := 512
 	batch := make([][]byte, batchsize)
@@ -193,6 +304,71 @@ func TestBatch(t *testing.T) {
 	}
 }
 
+func TestBatch_MixedLengths(t *testing.T) {
+	rand.Seed(1)
+	for round := 0; round < 20; round++ {
+		base := make([]byte, rand.Intn(40))
+		rand.Read(base)
+		batch := make([][]byte, 1+rand.Intn(20))
+		for i := range batch {
+			batch[i] = make([]byte, rand.Intn(80))
+			rand.Read(batch[i])
+		}
+
+		results := lx.HashParallel(base, batch)
+		if len(results) != len(batch) {
+			t.Fatalf("got %d results, want %d", len(results), len(batch))
+		}
+		for i := range batch {
+			want := lx.Hash(append(append([]byte(nil), base...), batch[i]...))
+			if !bytes.Equal(results[i], want) {
+				t.Errorf("item %d of %d bytes: got = %x, want = %x", i, len(batch[i]), results[i], want)
+			}
+		}
+	}
+}
+
+func TestBatch_Allocs(t *testing.T) {
+	batch := make([][]byte, 64)
+	for i := range batch {
+		batch[i] = make([]byte, 4)
+		binary.BigEndian.PutUint32(batch[i], uint32(i))
+	}
+	lx.HashParallel(oprhash, batch)
+	// the results and their backing store, and the receiver the pooled BatchHasher points to
+	allocs := testing.AllocsPerRun(10, func() {
+		lx.HashParallel(oprhash, batch)
+	})
+	if allocs > 3 {
+		t.Errorf("HashParallel allocates: %v allocs/op, want at most 3", allocs)
+	}
+}
+
+func TestBatch_Errors(t *testing.T) {
+	var none LXRHash
+	for _, tt := range []struct {
+		name  string
+		lx    LXRHash
+		batch [][]byte
+		want  error
+	}{
+		{"empty batch", lx, nil, ErrEmptyBatch},
+		{"no table", none, [][]byte{{1}}, ErrNoTable},
+	} {
+		if _, err := tt.lx.HashBatch(oprhash, tt.batch); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got = %v, want = %v", tt.name, err, tt.want)
+		}
+		func() {
+			defer func() {
+				if err, _ := recover().(error); !errors.Is(err, tt.want) {
+					t.Errorf("%s: HashParallel panicked with %v, want = %v", tt.name, err, tt.want)
+				}
+			}()
+			tt.lx.HashParallel(oprhash, tt.batch)
+		}()
+	}
+}
+
 func TestAbortSettings(t *testing.T) {
 	if b, v := AbortSettings(0xffac55c69ecabf4f); b != 1 || v != 0xac {
 		t.Errorf("unexpected")
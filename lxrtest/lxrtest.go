@@ -0,0 +1,92 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+
+// Package lxrtest provides LXRHash hashers for the tests of packages that use LXRHash, so
+// they need not load a full size table.
+//
+// Small returns a real LXRHash with a 1 KiB table, generated in memory in well under a
+// millisecond.  Its hashes differ from those of the full size table, but it exercises the
+// real algorithm.  Fake returns a hasher that only imitates LXRHash, for tests that need
+// fast, deterministic hashes of the right size and nothing more.
+package lxrtest
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"sync"
+
+	lxr "github.com/pegnet/LXRHash"
+)
+
+// SmallParams returns the parameters of the Small hasher: the default seed, passes and hash
+// size with a 10 bit table
+func SmallParams() lxr.Params {
+	p := lxr.DefaultParams()
+	p.MapSizeBits = 10
+	return p
+}
+
+var (
+	smallOnce sync.Once
+	small     *lxr.LXRHash
+)
+
+// Small returns a shared LXRHash with the SmallParams, generated in memory on first use
+func Small() *lxr.LXRHash {
+	smallOnce.Do(func() {
+		var err error
+		small, err = lxr.New(SmallParams(), lxr.WithEphemeral())
+		if err != nil {
+			panic(err)
+		}
+	})
+	return small
+}
+
+// Fake is a deterministic stand in for LXRHash.  Its hashes are HashSize bytes derived from
+// SHA-256 of the seed and the input; they are not LXRHash hashes.
+type Fake struct {
+	params lxr.Params
+}
+
+var _ lxr.Hasher = (*Fake)(nil)
+
+// NewFake returns a Fake with the parameters p.  No table is generated, so any parameters
+// are accepted.
+func NewFake(p lxr.Params) *Fake {
+	return &Fake{params: p}
+}
+
+// Params returns the parameters of the Fake
+func (f *Fake) Params() lxr.Params {
+	return f.params
+}
+
+// Hash returns the fake hash of src
+func (f *Fake) Hash(src []byte) []byte {
+	size := (f.params.HashSize + 7) / 8
+	out := make([]byte, 0, size+sha256.Size)
+	var block [16]byte
+	binary.BigEndian.PutUint64(block[:8], f.params.Seed)
+	for counter := uint64(0); uint64(len(out)) < size; counter++ {
+		binary.BigEndian.PutUint64(block[8:], counter)
+		h := sha256.New()
+		h.Write(block[:])
+		h.Write(src)
+		out = h.Sum(out)
+	}
+	return out[:size]
+}
+
+// HashBatch returns the fake hash of base followed by each entry of batch, with the same
+// errors as LXRHash.HashBatch
+func (f *Fake) HashBatch(base []byte, batch [][]byte) ([][]byte, error) {
+	if len(batch) == 0 {
+		return nil, lxr.ErrEmptyBatch
+	}
+	ret := make([][]byte, len(batch))
+	for i, src := range batch {
+		ret[i] = f.Hash(append(append([]byte(nil), base...), src...))
+	}
+	return ret, nil
+}
@@ -0,0 +1,58 @@
+package lxrtest
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	lxr "github.com/pegnet/LXRHash"
+)
+
+func TestSmall(t *testing.T) {
+	l := Small()
+	if l != Small() {
+		t.Error("Small is not shared")
+	}
+	if l.Params() != SmallParams() {
+		t.Errorf("params: got = %v, want = %v", l.Params(), SmallParams())
+	}
+	if want, ok := lxr.KnownFingerprint(SmallParams()); ok && l.Fingerprint() != want {
+		t.Errorf("fingerprint: got = %x, want = %x", l.Fingerprint(), want)
+	}
+	if got := l.Hash([]byte("foo")); len(got) != 32 {
+		t.Errorf("hash size: got = %d, want = 32", len(got))
+	}
+}
+
+func TestFake(t *testing.T) {
+	p := lxr.DefaultParams()
+	f := NewFake(p)
+	var h lxr.Hasher = f
+
+	a, b := h.Hash([]byte("foo")), h.Hash([]byte("foo"))
+	if !bytes.Equal(a, b) {
+		t.Errorf("not deterministic: %x, %x", a, b)
+	}
+	if bytes.Equal(a, h.Hash([]byte("bar"))) {
+		t.Error("different inputs hash the same")
+	}
+	if len(a) != 32 {
+		t.Errorf("hash size: got = %d, want = 32", len(a))
+	}
+
+	p.HashSize = 516 // more than one SHA-256, and 64.5 bytes, so rounded up to 65
+	if got := NewFake(p).Hash(nil); len(got) != 65 {
+		t.Errorf("hash size: got = %d, want = 65", len(got))
+	}
+
+	res, err := h.HashBatch([]byte("fo"), [][]byte{[]byte("o"), []byte("")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(res[0], a) || !bytes.Equal(res[1], h.Hash([]byte("fo"))) {
+		t.Errorf("HashBatch differs from Hash: %x", res)
+	}
+	if _, err := h.HashBatch(nil, nil); !errors.Is(err, lxr.ErrEmptyBatch) {
+		t.Errorf("empty batch: got = %v, want = %v", err, lxr.ErrEmptyBatch)
+	}
+}
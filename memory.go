@@ -0,0 +1,175 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package lxr
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// The ByteMap is by far the largest allocation in a process using LXRHash.  In the Go heap, a 1 GiB
+// table lets the garbage collector grow the heap to about 2 GiB before collecting (with the default
+// GOGC).  With WithOffHeap, the table lives in anonymous memory mappings outside the heap instead,
+// and is released explicitly by Close.
+//
+// Hashing is dominated by random reads of the ByteMap, so with 4 KiB pages most reads also miss
+// the TLB.  WithTransparentHugePages and WithHugeTLB ask for the table to be backed by huge pages,
+// and WithMlock keeps it from being swapped out.  All of these fall back quietly (logging a
+// warning) if the system refuses; Memory reports what was actually obtained.
+
+// Huge page modes
+const (
+	noHugePages = iota
+	transparentHugePages
+	hugeTLBPages
+)
+
+// MemoryReport describes the memory holding the ByteMap
+type MemoryReport struct {
+	OffHeap    bool // In an anonymous mapping outside the Go heap
+	FileMapped bool // In a shared read only mapping of the table file
+	HugeTLB    bool // Backed by hugetlbfs huge pages
+	HugeAdvise bool // The kernel accepted madvise(MADV_HUGEPAGE) for transparent huge pages
+	Locked     bool // Locked into RAM with mlock
+}
+
+// Memory reports how the ByteMap is held in memory
+func (lx *LXRHash) Memory() MemoryReport {
+	return lx.memory
+}
+
+// wantOffHeap is true if ByteMaps that are not file mappings should be allocated off heap
+func (lx *LXRHash) wantOffHeap() bool {
+	return (lx.offHeap || lx.hugePages != noHugePages) && mmapSupported
+}
+
+// allocAnon allocates zeroed memory outside the heap, using hugetlbfs pages if requested and available
+func (lx *LXRHash) allocAnon(size int) ([]byte, error) {
+	if lx.hugePages == hugeTLBPages {
+		mem, err := mmapHugeTLB(size)
+		if err == nil {
+			lx.memory.HugeTLB = true
+			return mem, nil
+		}
+		lx.log().Warn("huge pages unavailable, using normal pages", "error", err)
+	}
+	return mmapAnon(size)
+}
+
+// allocTable returns zeroed memory for a ByteMap of size bytes.  Off heap memory is recorded
+// in lx.mapping so Close can release it.  Falls back to the heap when off heap memory is not
+// available.
+func (lx *LXRHash) allocTable(size int) []byte {
+	if lx.wantOffHeap() {
+		lx.releaseMapping()
+	}
+	mem, mapped := lx.newTable(size)
+	if mapped {
+		lx.mapping = mem
+		lx.memory.OffHeap = true
+	}
+	return mem
+}
+
+// newTable returns zeroed memory for a ByteMap of size bytes, off heap if asked for and
+// available, leaving the current ByteMap alone.  mapped is true if the result must be
+// released with munmap.
+func (lx *LXRHash) newTable(size int) (mem []byte, mapped bool) {
+	if lx.wantOffHeap() {
+		mem, err := lx.allocAnon(size)
+		if err == nil {
+			return mem, true
+		}
+		lx.log().Warn("off heap allocation failed, using the heap", "error", err)
+	}
+	return make([]byte, size), false
+}
+
+// readFile reads a table file into memory, using a shared file mapping with WithMmap, or off heap
+// memory with WithOffHeap.  mapped is true if the result must be released with munmap.
+func (lx *LXRHash) readFile(filename string) (dat []byte, mapped bool, err error) {
+	switch {
+	case lx.useMmap && mmapSupported:
+		dat, err = mmapFile(filename)
+		return dat, err == nil, err
+	case lx.wantOffHeap():
+		dat, err = lx.readFileAnon(filename)
+		return dat, err == nil, err
+	}
+	dat, err = ioutil.ReadFile(filename)
+	return dat, false, err
+}
+
+// readFileAnon reads a file into off heap memory
+func (lx *LXRHash) readFileAnon(filename string) ([]byte, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := fi.Size()
+	if size == 0 {
+		return []byte{}, nil
+	}
+	if int64(int(size)) != size {
+		return nil, fmt.Errorf("file of %d bytes is too large to map", size)
+	}
+	mem, err := lx.allocAnon(int(size))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(f, mem); err != nil {
+		munmap(mem)
+		return nil, err
+	}
+	return mem, nil
+}
+
+// tuneMemory applies the huge page and locking options to the loaded ByteMap and records the
+// result in lx.memory
+func (lx *LXRHash) tuneMemory() {
+	lx.memory.FileMapped = lx.mapping != nil && lx.useMmap
+	lx.memory.OffHeap = lx.mapping != nil && !lx.useMmap
+	if lx.mapping == nil {
+		lx.memory.HugeTLB = false
+	}
+
+	if lx.hugePages != noHugePages && lx.mapping != nil && !lx.memory.HugeTLB {
+		if err := madviseHugePage(lx.mapping); err != nil {
+			lx.log().Warn("transparent huge pages unavailable", "error", err)
+		} else {
+			lx.memory.HugeAdvise = true
+		}
+	}
+
+	if lx.lockTable && !lx.memory.Locked {
+		if err := mlock(lx.ByteMap); err != nil {
+			lx.log().Warn("locking table in RAM failed", "error", err)
+		} else {
+			lx.memory.Locked = true
+		}
+	}
+}
+
+// releaseMapping unmaps the memory holding the ByteMap, if it is mapped, and undoes
+// any locking of a ByteMap in the heap
+func (lx *LXRHash) releaseMapping() error {
+	if lx.mapping == nil {
+		if lx.memory.Locked && lx.ByteMap != nil {
+			munlock(lx.ByteMap)
+		}
+		lx.memory = MemoryReport{}
+		return nil
+	}
+	err := munmap(lx.mapping)
+	lx.mapping = nil
+	lx.memory = MemoryReport{}
+	return err
+}
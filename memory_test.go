@@ -0,0 +1,112 @@
+package lxr
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"testing"
+)
+
+func TestWithOffHeap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lxrtables")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := Params{Seed: Seed, MapSizeBits: 20, HashSize: HashSize, Passes: Passes}
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	// generated
+	generated, err := NewFromPath(p, dir, WithOffHeap())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// read from disk
+	loaded, err := NewFromPath(p, dir, WithOffHeap())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	if mmapSupported {
+		if generated.mapping == nil || loaded.mapping == nil {
+			t.Errorf("table is not off heap")
+		}
+		if grown := int64(after.HeapAlloc) - int64(before.HeapAlloc); grown > int64(len(generated.ByteMap)) {
+			t.Errorf("heap grew by %d bytes for two tables of %d bytes", grown, len(generated.ByteMap))
+		}
+	}
+
+	heap, err := NewFromPath(p, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(heap.ByteMap, generated.ByteMap) || !bytes.Equal(heap.ByteMap, loaded.ByteMap) {
+		t.Errorf("off heap table differs")
+	}
+
+	for _, l := range []*LXRHash{generated, loaded} {
+		if err := l.Close(); err != nil {
+			t.Errorf("close: %v", err)
+		}
+		if l.mapping != nil || l.ByteMap != nil {
+			t.Errorf("table not released")
+		}
+	}
+}
+
+func TestMemoryOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lxrtables")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := Params{Seed: Seed, MapSizeBits: 16, HashSize: HashSize, Passes: Passes}
+	heap, err := NewFromPath(p, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := heap.Memory(); m != (MemoryReport{}) {
+		t.Errorf("plain table reports %+v", m)
+	}
+
+	buf := []byte("test string")
+	want := heap.Hash(buf)
+
+	for name, opts := range map[string][]Option{
+		"thp":         {WithTransparentHugePages()},
+		"hugetlb":     {WithHugeTLB()},
+		"mlock":       {WithMlock()},
+		"mmap thp":    {WithMmap(), WithTransparentHugePages()},
+		"hugetlb all": {WithHugeTLB(), WithMlock()},
+	} {
+		l, err := NewFromPath(p, dir, opts...)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !bytes.Equal(l.Hash(buf), want) {
+			t.Errorf("%s: hash differs", name)
+		}
+		m := l.Memory()
+		t.Logf("%s: %+v", name, m)
+		if mmapSupported && l.hugePages != noHugePages && !m.OffHeap && !m.FileMapped {
+			t.Errorf("%s: huge pages requested but table is in the heap", name)
+		}
+		if m.HugeTLB && m.HugeAdvise {
+			t.Errorf("%s: both hugetlb and transparent huge pages", name)
+		}
+		if err := l.Close(); err != nil {
+			t.Errorf("%s: close: %v", name, err)
+		}
+		if m := l.Memory(); m != (MemoryReport{}) {
+			t.Errorf("%s: closed table reports %+v", name, m)
+		}
+	}
+}
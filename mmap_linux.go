@@ -0,0 +1,78 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+
+//go:build linux
+// +build linux
+
+package lxr
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+const mmapSupported = true
+
+// mmapFile maps the whole file read only.  The mapping is shared, so every process mapping
+// the same file uses the same page cache copy.
+func mmapFile(filename string) ([]byte, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := fi.Size()
+	if size == 0 {
+		return []byte{}, nil
+	}
+	if int64(int(size)) != size {
+		return nil, fmt.Errorf("file of %d bytes is too large to map", size)
+	}
+	return syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+// munmap releases a mapping returned by mmapFile, mmapAnon or mmapHugeTLB.  The slice
+// may be shortened, but must start at the start of the mapping.
+func munmap(b []byte) error {
+	if cap(b) == 0 {
+		return nil
+	}
+	return syscall.Munmap(b[:cap(b)])
+}
+
+// mmapAnon allocates zeroed, writable memory outside the Go heap
+func mmapAnon(size int) ([]byte, error) {
+	return syscall.Mmap(-1, 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_PRIVATE|syscall.MAP_ANON)
+}
+
+// hugePageSize is the size of the default huge page on the platforms we support
+const hugePageSize = 2 << 20
+
+// mmapHugeTLB allocates zeroed, writable memory backed by hugetlbfs pages.  The length is rounded
+// up to a whole number of huge pages; the result is sliced to size.
+func mmapHugeTLB(size int) ([]byte, error) {
+	length := (size + hugePageSize - 1) / hugePageSize * hugePageSize
+	mem, err := syscall.Mmap(-1, 0, length, syscall.PROT_READ|syscall.PROT_WRITE,
+		syscall.MAP_PRIVATE|syscall.MAP_ANON|syscall.MAP_HUGETLB)
+	if err != nil {
+		return nil, err
+	}
+	return mem[:size], nil
+}
+
+// madviseHugePage asks the kernel to back a mapping with transparent huge pages
+func madviseHugePage(b []byte) error {
+	return syscall.Madvise(b, syscall.MADV_HUGEPAGE)
+}
+
+// mlock locks memory into RAM so it is never swapped out
+func mlock(b []byte) error { return syscall.Mlock(b) }
+
+// munlock undoes mlock
+func munlock(b []byte) error { return syscall.Munlock(b) }
@@ -0,0 +1,27 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+
+//go:build !linux
+// +build !linux
+
+package lxr
+
+import "errors"
+
+const mmapSupported = false
+
+var errMmapUnsupported = errors.New("memory mapping is not supported on this platform")
+
+func mmapFile(filename string) ([]byte, error) { return nil, errMmapUnsupported }
+
+func munmap(b []byte) error { return errMmapUnsupported }
+
+func mmapAnon(size int) ([]byte, error) { return nil, errMmapUnsupported }
+
+func mmapHugeTLB(size int) ([]byte, error) { return nil, errMmapUnsupported }
+
+func madviseHugePage(b []byte) error { return errMmapUnsupported }
+
+func mlock(b []byte) error { return errMmapUnsupported }
+
+func munlock(b []byte) error { return errMmapUnsupported }
@@ -0,0 +1,125 @@
+package lxr
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWithMmap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lxrtables")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := Params{Seed: Seed, MapSizeBits: 12, HashSize: HashSize, Passes: Passes}
+
+	// generated, written, then mapped
+	mapped, err := NewFromPath(p, dir, WithMmap())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mmapSupported && mapped.mapping == nil {
+		t.Errorf("generated table is not mapped")
+	}
+
+	heap, err := NewFromPath(p, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if heap.mapping != nil {
+		t.Errorf("table mapped without WithMmap")
+	}
+
+	// read from disk and mapped
+	mapped2, err := NewFromPath(p, dir, WithMmap())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := []byte("test string")
+	if !bytes.Equal(heap.ByteMap, mapped.ByteMap) || !bytes.Equal(heap.ByteMap, mapped2.ByteMap) {
+		t.Errorf("mapped table differs")
+	}
+	if !bytes.Equal(heap.Hash(buf), mapped2.Hash(buf)) {
+		t.Errorf("mapped table hashes differently")
+	}
+
+	for _, l := range []*LXRHash{mapped, mapped2, heap} {
+		if err := l.Close(); err != nil {
+			t.Errorf("close: %v", err)
+		}
+		if l.mapping != nil || l.ByteMap != nil {
+			t.Errorf("table not released")
+		}
+	}
+}
+
+func TestRelease_Mmap(t *testing.T) {
+	p := Params{Seed: Seed, MapSizeBits: 9, HashSize: HashSize, Passes: Passes}
+	one, err := NewShared(p, WithMmap())
+	if err != nil {
+		t.Fatal(err)
+	}
+	two, err := NewShared(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Release(one)
+	if two.ByteMap == nil {
+		t.Errorf("table released with a reference left")
+	}
+	Release(two)
+	if mmapSupported && (two.ByteMap != nil || two.mapping != nil) {
+		t.Errorf("mapped table not released with the last reference")
+	}
+}
+
+// mappingsOf counts the mappings of a file by this process, or returns -1 if that is unknown
+func mappingsOf(filename string) int {
+	maps, err := ioutil.ReadFile("/proc/self/maps")
+	if err != nil {
+		return -1
+	}
+	return strings.Count(string(maps), filename)
+}
+
+func TestWithMmap_Reload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lxrtables")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := Params{Seed: Seed, MapSizeBits: 12, HashSize: HashSize, Passes: Passes}
+	l, err := NewFromPath(p, dir, WithMmap())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	filename := filepath.Join(dir, p.TableFilename())
+	if !mmapSupported || mappingsOf(filename) < 0 {
+		t.Skip("mappings cannot be counted")
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := l.InitFromPath(p.Seed, p.MapSizeBits, p.HashSize, p.Passes, dir); err != nil {
+			t.Fatal(err)
+		}
+		if n := mappingsOf(filename); n != 1 {
+			t.Fatalf("reload %d: table mapped %d times, want once", i, n)
+		}
+	}
+	heap, err := NewFromPath(p, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(l.ByteMap, heap.ByteMap) {
+		t.Errorf("table read incorrectly after reload")
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package lxr
+
+import (
+	"context"
+	"crypto/sha256"
+)
+
+// Option configures how an LXRHash loads its ByteMap.  Options are passed to New, NewFromPath
+// and NewShared.  For a NewShared instance, the options of the first caller apply.
+type Option func(*LXRHash)
+
+// WithVerbose enables or disables the output of progress indicators, see Verbose
+func WithVerbose(val bool) Option {
+	return func(lx *LXRHash) { lx.verbose = val }
+}
+
+// WithLegacyUpgrade rewrites legacy headerless table files with a header when they are loaded,
+// so the checksum is verified on every later load.
+func WithLegacyUpgrade() Option {
+	return func(lx *LXRHash) { lx.upgradeLegacy = true }
+}
+
+// WithMmap memory maps the table file rather than reading it into the Go heap.  The mapping
+// is read only and shared, so processes using the same table file share one copy of it in
+// the page cache.  Close unmaps the table.  Where memory mapping is not supported, the table
+// is read into the heap as usual.
+func WithMmap() Option {
+	return func(lx *LXRHash) { lx.useMmap = true }
+}
+
+// WithOffHeap allocates the ByteMap, whether generated or read from disk, outside the Go heap,
+// so a large table does not inflate the heap target of the garbage collector.  Close releases
+// the memory.  Where this is not supported, the table is kept in the heap as usual.
+func WithOffHeap() Option {
+	return func(lx *LXRHash) { lx.offHeap = true }
+}
+
+// WithTransparentHugePages asks the kernel to back the ByteMap with transparent huge pages,
+// which cuts TLB misses on large tables.  Implies WithOffHeap unless WithMmap is used.
+func WithTransparentHugePages() Option {
+	return func(lx *LXRHash) { lx.hugePages = transparentHugePages }
+}
+
+// WithHugeTLB allocates the ByteMap in hugetlbfs huge pages, which must have been reserved
+// by the system administrator (see /proc/sys/vm/nr_hugepages).  Falls back to transparent
+// huge pages if none are available.  Implies WithOffHeap; ignored for WithMmap.
+func WithHugeTLB() Option {
+	return func(lx *LXRHash) { lx.hugePages = hugeTLBPages }
+}
+
+// WithMlock locks the ByteMap into RAM so it is never swapped out.  This is limited by
+// RLIMIT_MEMLOCK.
+func WithMlock() Option {
+	return func(lx *LXRHash) { lx.lockTable = true }
+}
+
+// WithContext lets ctx cancel generating the table, or waiting for another process to
+// generate it.  Loading then fails with ctx.Err().
+func WithContext(ctx context.Context) Option {
+	return func(lx *LXRHash) { lx.ctx = ctx }
+}
+
+// WithProgress has progress called regularly while the table is generated, see GenerateTableContext
+func WithProgress(progress func(Progress)) Option {
+	return func(lx *LXRHash) { lx.progress = progress }
+}
+
+// context returns the context given by WithContext, or the background context
+func (lx *LXRHash) context() context.Context {
+	if lx.ctx == nil {
+		return context.Background()
+	}
+	return lx.ctx
+}
+
+// WithNoGenerate makes loading fail, rather than generate a table, when the table file is
+// missing (ErrTableNotFound) or invalid (ErrTableCorrupt).  Nothing is ever written, so this
+// suits tables provisioned on read only filesystems.
+func WithNoGenerate() Option {
+	return func(lx *LXRHash) { lx.noGenerate = true }
+}
+
+// WithEphemeral generates the table in memory without reading or writing any files, and
+// without needing a home directory.  The table path is ignored.
+func WithEphemeral() Option {
+	return func(lx *LXRHash) { lx.ephemeral = true }
+}
+
+// WithSearchPath replaces the table search path (see TableSearchPath) used by New and NewShared
+func WithSearchPath(dirs ...string) Option {
+	return func(lx *LXRHash) { lx.searchPath = dirs }
+}
+
+// WithFingerprint requires the ByteMap, however it is loaded or generated, to have the given
+// SHA-256 fingerprint, in place of any known fingerprint for the parameters (see
+// KnownFingerprint).  Loading fails with ErrFingerprintMismatch otherwise.
+func WithFingerprint(fingerprint [sha256.Size]byte) Option {
+	return func(lx *LXRHash) { lx.wantFingerprint = &fingerprint }
+}
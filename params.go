@@ -0,0 +1,109 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package lxr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Limits on the parameters accepted by Validate
+const (
+	MinMapSizeBits = uint64(8)  // Smallest ByteMap, 256 bytes
+	MaxMapSizeBits = uint64(34) // Largest ByteMap, 16 GiB
+	MaxPasses      = uint64(64) // More shuffles than this only cost time
+)
+
+// Params holds the values that define an LXRHash "hash space".
+//
+// The canonical string form is seed:bits:hashbits:passes, with the seed in hex, e.g.
+//
+//	0xfafaececfafaecec:30:256:5
+type Params struct {
+	Seed        uint64 // An arbitrary number used to create the tables
+	MapSizeBits uint64 // Size of the ByteMap in bits, i.e. 10 = map size of 1024
+	HashSize    uint64 // Number of bits in the hash; truncated to a byte boundary
+	Passes      uint64 // Number of shuffles of the ByteMap
+}
+
+// DefaultParams returns the default parameters defined in constants.go
+func DefaultParams() Params {
+	return Params{Seed: Seed, MapSizeBits: MapSizeBits, HashSize: HashSize, Passes: Passes}
+}
+
+// ParseParams parses the form seed:bits:hashbits:passes.  Each field may be written in
+// decimal or, with a 0x prefix, in hex.  The result is validated.
+func ParseParams(s string) (Params, error) {
+	var p Params
+	fields := strings.Split(s, ":")
+	if len(fields) != 4 {
+		return p, fmt.Errorf("%w: %q is not of the form seed:bits:hashbits:passes", ErrBadParams, s)
+	}
+	dst := []*uint64{&p.Seed, &p.MapSizeBits, &p.HashSize, &p.Passes}
+	for i, f := range fields {
+		v, err := strconv.ParseUint(strings.TrimSpace(f), 0, 64)
+		if err != nil {
+			return Params{}, fmt.Errorf("%w: %q: %v", ErrBadParams, s, err)
+		}
+		*dst[i] = v
+	}
+	if err := p.Validate(); err != nil {
+		return Params{}, err
+	}
+	return p, nil
+}
+
+// Validate checks that the parameters describe a hash space we can build
+func (p Params) Validate() error {
+	if p.MapSizeBits < MinMapSizeBits || p.MapSizeBits > MaxMapSizeBits {
+		return badMapSize(p.MapSizeBits)
+	}
+	if p.HashSize == 0 {
+		return fmt.Errorf("%w: must be at least 1 bit", ErrBadHashSize)
+	}
+	if p.Passes == 0 || p.Passes > MaxPasses {
+		return fmt.Errorf("%w: must be between 1 and %d, was %d", ErrBadPasses, MaxPasses, p.Passes)
+	}
+	return nil
+}
+
+// String returns the parameters in the form seed:bits:hashbits:passes
+func (p Params) String() string {
+	return fmt.Sprintf("%#x:%d:%d:%d", p.Seed, p.MapSizeBits, p.HashSize, p.Passes)
+}
+
+// ID returns the canonical identifier of the hash space.  Parameters that produce the
+// same hashes have the same ID; the hash size is rounded up to a byte boundary.
+func (p Params) ID() string {
+	p.HashSize = (p.HashSize + 7) / 8 * 8
+	return p.String()
+}
+
+// TableFilename returns the name of the file holding the ByteMap for these parameters.
+// The hash size is not part of the name since it does not affect the ByteMap.
+func (p Params) TableFilename() string {
+	return fmt.Sprintf("lxrhash-seed-%x-passes-%d-size-%d.dat", p.Seed, p.Passes, p.MapSizeBits)
+}
+
+// MarshalText encodes the parameters in the form seed:bits:hashbits:passes.
+// This is also used for JSON.
+func (p Params) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// UnmarshalText decodes and validates parameters in the form seed:bits:hashbits:passes.
+// This is also used for JSON.
+func (p *Params) UnmarshalText(text []byte) error {
+	np, err := ParseParams(string(text))
+	if err != nil {
+		return err
+	}
+	*p = np
+	return nil
+}
+
+// Params returns the parameters the hash was initialized with
+func (lx *LXRHash) Params() Params {
+	return Params{Seed: lx.Seed, MapSizeBits: lx.MapSizeBits, HashSize: lx.HashSize * 8, Passes: lx.Passes}
+}
@@ -0,0 +1,106 @@
+package lxr
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParams_Validate(t *testing.T) {
+	good := DefaultParams()
+	if err := good.Validate(); err != nil {
+		t.Errorf("default params invalid: %v", err)
+	}
+
+	bad := map[error][]Params{
+		ErrBadMapSize: {
+			{Seed: Seed, MapSizeBits: 7, HashSize: HashSize, Passes: Passes},
+			{Seed: Seed, MapSizeBits: 35, HashSize: HashSize, Passes: Passes},
+		},
+		ErrBadHashSize: {
+			{Seed: Seed, MapSizeBits: 8, HashSize: 0, Passes: Passes},
+		},
+		ErrBadPasses: {
+			{Seed: Seed, MapSizeBits: 8, HashSize: HashSize, Passes: 0},
+			{Seed: Seed, MapSizeBits: 8, HashSize: HashSize, Passes: MaxPasses + 1},
+		},
+	}
+	for want, list := range bad {
+		for _, p := range list {
+			if err := p.Validate(); !errors.Is(err, want) {
+				t.Errorf("%s: got = %v, want = %v", p, err, want)
+			}
+		}
+	}
+}
+
+func TestParseParams(t *testing.T) {
+	p, err := ParseParams("0xfafaececfafaecec:30:256:5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p != DefaultParams() {
+		t.Errorf("got = %+v, want = %+v", p, DefaultParams())
+	}
+
+	if p, err = ParseParams("18085027756226833644:10:0x100:5"); err != nil || p.Seed != Seed || p.HashSize != 256 {
+		t.Errorf("decimal seed: got = %+v, %v", p, err)
+	}
+
+	for _, s := range []string{"", "1:2:3", "x:30:256:5", "1:30:256:5:1", "1:7:256:5"} {
+		if _, err := ParseParams(s); err == nil {
+			t.Errorf("%q: no error", s)
+		}
+	}
+
+	// round trip
+	if p, err := ParseParams(DefaultParams().String()); err != nil || p != DefaultParams() {
+		t.Errorf("round trip: got = %+v, %v", p, err)
+	}
+}
+
+func TestParams_ID(t *testing.T) {
+	a := Params{Seed: Seed, MapSizeBits: 10, HashSize: 250, Passes: Passes}
+	b := Params{Seed: Seed, MapSizeBits: 10, HashSize: 256, Passes: Passes}
+	if a.ID() != b.ID() {
+		t.Errorf("hash sizes with the same byte length differ: %s, %s", a.ID(), b.ID())
+	}
+	b.HashSize = 264
+	if a.ID() == b.ID() {
+		t.Errorf("different hash sizes have the same id: %s", a.ID())
+	}
+	if got, want := DefaultParams().TableFilename(), "lxrhash-seed-fafaececfafaecec-passes-5-size-30.dat"; got != want {
+		t.Errorf("table filename: got = %s, want = %s", got, want)
+	}
+}
+
+func TestParams_JSON(t *testing.T) {
+	type config struct {
+		Hash Params `json:"hash"`
+	}
+	data, err := json.Marshal(config{Hash: DefaultParams()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"hash":"0xfafaececfafaecec:30:256:5"}` {
+		t.Errorf("unexpected encoding %s", data)
+	}
+
+	var c config
+	if err := json.Unmarshal(data, &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Hash != DefaultParams() {
+		t.Errorf("got = %+v, want = %+v", c.Hash, DefaultParams())
+	}
+
+	if err := json.Unmarshal([]byte(`{"hash":"0x1:40:256:5"}`), &c); !errors.Is(err, ErrBadMapSize) {
+		t.Errorf("invalid params: got = %v, want = %v", err, ErrBadMapSize)
+	}
+}
+
+func TestLXRHash_Params(t *testing.T) {
+	if got := lx.Params(); got != DefaultParams() {
+		t.Errorf("got = %+v, want = %+v", got, DefaultParams())
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+
+// Package ref is a reference implementation of LXRHash.  It is written to be read line by line
+// against the description of the algorithm, by auditors and by authors of implementations in
+// other languages, and makes no attempt to be fast.  It does not depend on package lxr, and
+// the tests of package lxr check that every kernel there agrees with it.
+//
+// All arithmetic is on unsigned 64 bit integers and wraps; shifts by 64 or more give 0.
+package ref
+
+// The starting state of the generator that shuffles the table
+const (
+	FirstRand = uint64(2458719153079158768)
+	FirstB    = uint64(4631534797403582785)
+	FirstV    = uint64(3523455478921636871)
+)
+
+// Table returns the ByteMap for a seed, a number of shuffle passes and a table of 2^bits bytes.
+//
+// The table starts as the byte values 0, 1, ... 255 repeated to fill it, so it holds every byte
+// value equally often.  It is then shuffled passes times: each byte in turn is swapped with
+// one at an index drawn from a generator that itself reads the table.
+func Table(seed, passes, bits uint64) []byte {
+	size := uint64(1) << bits
+	mask := size - 1
+
+	table := make([]byte, size)
+	for i := uint64(0); i < size; i++ {
+		table[i] = byte(i % 256)
+	}
+
+	offset := seed ^ FirstRand
+	b := seed ^ FirstB
+	v := FirstV
+	for pass := uint64(0); pass < passes; pass++ {
+		for i := uint64(0); i < size; i++ {
+			// draw the index to swap with
+			offset = (offset << 9) ^ (offset >> 1) ^ (offset >> 7) ^ b
+			v = uint64(table[(offset^b)&mask]) ^ (v << 8) ^ (v >> 1)
+			b = (v << 7) ^ (v << 13) ^ (v << 33) ^ (v << 52) ^ (b << 9) ^ (b >> 1)
+			j := offset & mask
+
+			table[i], table[j] = table[j], table[i]
+		}
+	}
+	return table
+}
+
+// state is the state of a hash in progress
+type state struct {
+	table []byte
+	mask  uint64   // len(table) - 1
+	as    uint64   // Accumulated state
+	s1    uint64   // Three rolling states
+	s2    uint64   //
+	s3    uint64   //
+	hs    []uint64 // Intermediate result for each byte of the hash
+}
+
+// lookup returns the table byte at x, with x reduced to the size of the table
+func (st *state) lookup(x uint64) uint64 {
+	return uint64(st.table[x&st.mask])
+}
+
+// rotate rolls the three states along: s1 takes s3, s2 takes s1 and s3 takes s2
+func (st *state) rotate() {
+	s1, s2, s3 := st.s1, st.s2, st.s3
+	st.s1 = s3
+	st.s2 = s1
+	st.s3 = s2
+}
+
+// fastStep mixes the input value v into the state and into hs[idx], with one table read
+func (st *state) fastStep(v uint64, idx int) {
+	b := st.lookup(st.as ^ v)
+	st.as = (st.as << 7) ^ (st.as >> 5) ^ (v << 20) ^ (v << 16) ^ v ^ (b << 20) ^ (b << 12) ^ (b << 4)
+	st.s1 = (st.s1 << 9) ^ (st.s1 >> 3) ^ st.hs[idx]
+	st.hs[idx] = st.s1 ^ st.as
+	st.rotate()
+}
+
+// step mixes the input value v into the state and into hs[idx], with 25 table reads.  Each
+// read depends on the one before, so they cannot be made in parallel.
+func (st *state) step(v uint64, idx int) {
+	L := st.lookup
+
+	st.s1 = (st.s1 << 9) ^ (st.s1 >> 1) ^ st.as ^ (L((st.as>>5)^v) << 3)
+	st.s1 = (st.s1 << 5) ^ (st.s1 >> 3) ^ (L(st.s1^v) << 7)
+	st.s1 = (st.s1 << 7) ^ (st.s1 >> 7) ^ (L(st.as^(st.s1>>7)) << 5)
+	st.s1 = (st.s1 << 11) ^ (st.s1 >> 5) ^ (L(v^(st.as>>11)^st.s1) << 27)
+
+	st.hs[idx] = st.s1 ^ st.as ^ (st.hs[idx] << 7) ^ (st.hs[idx] >> 13)
+
+	st.as = (st.as << 17) ^ (st.as >> 5) ^ st.s1 ^ (L(st.as^(st.s1>>27)^v) << 3)
+	st.as = (st.as << 13) ^ (st.as >> 3) ^ (L(st.as^st.s1) << 7)
+	st.as = (st.as << 15) ^ (st.as >> 7) ^ (L((st.as>>7)^st.s1) << 11)
+	st.as = (st.as << 9) ^ (st.as >> 11) ^ (L(v^st.as^st.s1) << 3)
+
+	st.s1 = (st.s1 << 7) ^ (st.s1 >> 27) ^ st.as ^ (L(st.as>>3) << 13)
+	st.s1 = (st.s1 << 3) ^ (st.s1 >> 13) ^ (L(st.s1^v) << 11)
+	st.s1 = (st.s1 << 8) ^ (st.s1 >> 11) ^ (L(st.as^(st.s1>>11)) << 9)
+	st.s1 = (st.s1 << 6) ^ (st.s1 >> 9) ^ (L(v^st.as^st.s1) << 3)
+
+	st.as = (st.as << 23) ^ (st.as >> 3) ^ st.s1 ^ (L(st.as^v^(st.s1>>3)) << 7)
+	st.as = (st.as << 17) ^ (st.as >> 7) ^ (L(st.as^(st.s1>>3)) << 5)
+	st.as = (st.as << 13) ^ (st.as >> 5) ^ (L((st.as>>5)^st.s1) << 1)
+	st.as = (st.as << 11) ^ (st.as >> 1) ^ (L(v^st.as^st.s1) << 7)
+
+	st.s1 = (st.s1 << 5) ^ (st.s1 >> 3) ^ st.as ^ (L((st.as>>7)^(st.s1>>3)) << 6)
+	st.s1 = (st.s1 << 8) ^ (st.s1 >> 6) ^ (L(st.s1^v) << 11)
+	st.s1 = (st.s1 << 11) ^ (st.s1 >> 11) ^ (L(st.as^(st.s1>>11)) << 5)
+	st.s1 = (st.s1 << 7) ^ (st.s1 >> 5) ^ (L(v^(st.as>>7)^st.as^st.s1) << 17)
+
+	st.s2 = (st.s2 << 3) ^ (st.s2 >> 17) ^ st.s1 ^ (L(st.as^(st.s2>>5)^v) << 13)
+	st.s2 = (st.s2 << 6) ^ (st.s2 >> 13) ^ (L(st.s2) << 11)
+	st.s2 = (st.s2 << 11) ^ (st.s2 >> 11) ^ (L(st.as^st.s1^(st.s2>>11)) << 23)
+	st.s2 = (st.s2 << 4) ^ (st.s2 >> 23) ^ (L(v^(st.as>>8)^st.as^(st.s2>>10)) << 1)
+
+	st.s1 = (st.s2 << 3) ^ (st.s2 >> 1) ^ st.hs[idx] ^ v
+	st.as = (st.as << 9) ^ (st.as >> 7) ^ (st.s1 >> 1) ^ (L((st.s2>>1)^st.hs[idx]) << 5)
+
+	st.rotate()
+}
+
+// State is the state of a hash between passes: the accumulated state, the three rolling
+// states and the intermediate results
+type State struct {
+	As, S1, S2, S3 uint64
+	HS             []uint64
+}
+
+// snapshot returns a copy of the state
+func (st *state) snapshot() State {
+	return State{As: st.as, S1: st.s1, S2: st.s2, S3: st.s3, HS: append([]uint64(nil), st.hs...)}
+}
+
+// Hash returns the hash of src, hashSize bytes long, computed with table, whose length must
+// be a power of two, and seed.
+//
+// The input is read twice.  The first pass makes one table read per byte, and the second 25
+// reads per byte, each byte of input updating the next of the hashSize intermediate results
+// in turn.  Finally each intermediate result, from the last to the first, is stepped through
+// once more and reduced to one byte of the hash.
+func Hash(table []byte, seed uint64, hashSize int, src []byte) []byte {
+	hash, _, _ := HashStates(table, seed, hashSize, src)
+	return hash
+}
+
+// HashStates is Hash, also returning the state after the first pass and after the second
+func HashStates(table []byte, seed uint64, hashSize int, src []byte) (hash []byte, first, second State) {
+	st := &state{
+		table: table,
+		mask:  uint64(len(table)) - 1,
+		as:    seed,
+		hs:    make([]uint64, hashSize),
+	}
+
+	// first pass
+	for i, c := range src {
+		st.fastStep(uint64(c), i%hashSize)
+	}
+	first = st.snapshot()
+
+	// second pass
+	for i, c := range src {
+		st.step(uint64(c), i%hashSize)
+	}
+	second = st.snapshot()
+
+	// reduction
+	hash = make([]byte, hashSize)
+	for i := hashSize - 1; i >= 0; i-- {
+		st.step(st.hs[i], i)
+		hash[i] = byte(st.lookup(st.as)) ^ byte(st.lookup(st.hs[i]))
+	}
+	return hash, first, second
+}
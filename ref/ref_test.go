@@ -0,0 +1,73 @@
+package ref
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+const (
+	seed   = uint64(0xFAFAECECFAFAECEC)
+	passes = uint64(5)
+)
+
+func TestTable(t *testing.T) {
+	// Fingerprints of the tables with the default seed and passes
+	known := map[uint64]string{
+		8:  "9855b17b807c041622d0f984b6004da28f0554b574f17de788abaa6a38135483",
+		10: "c1e50b47f68732bce96e3a01bf53d889071ef31b5732c3f07f460c6aa4adf204",
+		16: "7f5df9e4cd8216cabbbd73ce203a0073357a3e8941d32e0adbb65bd32b214461",
+	}
+	for bits, want := range known {
+		table := Table(seed, passes, bits)
+		counts := make([]int, 256)
+		for _, b := range table {
+			counts[b]++
+		}
+		for v, n := range counts {
+			if n != len(table)/256 {
+				t.Errorf("%d bits: byte %d appears %d times, want %d", bits, v, n, len(table)/256)
+				break
+			}
+		}
+		sum := sha256.Sum256(table)
+		if got := hex.EncodeToString(sum[:]); got != want {
+			t.Errorf("%d bits: got = %s, want = %s", bits, got, want)
+		}
+	}
+}
+
+func TestHash(t *testing.T) {
+	table := Table(seed, passes, 10)
+	h := Hash(table, seed, 32, []byte("foo"))
+	if len(h) != 32 {
+		t.Fatalf("size: got = %d, want = 32", len(h))
+	}
+	if h2 := Hash(table, seed, 32, []byte("fop")); string(h) == string(h2) {
+		t.Error("different inputs hash the same")
+	}
+	if h2 := Hash(table, seed+1, 32, []byte("foo")); string(h) == string(h2) {
+		t.Error("different seeds hash the same")
+	}
+	if h := Hash(table, seed, 5, nil); len(h) != 5 {
+		t.Errorf("size: got = %d, want = 5", len(h))
+	}
+}
+
+func TestHashStates(t *testing.T) {
+	table := Table(seed, passes, 10)
+	hash, first, second := HashStates(table, seed, 4, nil)
+	if string(hash) != string(Hash(table, seed, 4, nil)) {
+		t.Error("HashStates and Hash differ")
+	}
+	for _, st := range []State{first, second} {
+		if st.As != seed || st.S1|st.S2|st.S3 != 0 || len(st.HS) != 4 || st.HS[0]|st.HS[1]|st.HS[2]|st.HS[3] != 0 {
+			t.Errorf("no input: got state %+v, want the starting state", st)
+		}
+	}
+
+	_, first, second = HashStates(table, seed, 4, []byte("abcdef"))
+	if first.As == second.As || first.HS[0] == second.HS[0] {
+		t.Error("the second pass left the state unchanged")
+	}
+}
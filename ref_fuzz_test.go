@@ -0,0 +1,34 @@
+//go:build go1.18
+// +build go1.18
+
+package lxr
+
+import "testing"
+
+// FuzzDifferential checks every kernel against the reference for fuzzed parameters, inputs
+// and batch shapes.  Run with go test -fuzz FuzzDifferential.
+func FuzzDifferential(f *testing.F) {
+	f.Add(Seed, uint8(0), uint8(32), uint8(5), []byte("base"), []byte("batch input"), uint8(3), uint8(4))
+	f.Add(uint64(1), uint8(4), uint8(1), uint8(1), []byte{}, []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, uint8(1), uint8(1))
+	f.Fuzz(func(t *testing.T, seed uint64, bits, hashBytes, passes uint8, base, data []byte, items, width uint8) {
+		p := Params{
+			Seed:        seed,
+			MapSizeBits: MinMapSizeBits + uint64(bits%8),
+			HashSize:    8 * (1 + uint64(hashBytes%80)),
+			Passes:      1 + uint64(passes%5),
+		}
+		l := diffHasher(t, p)
+
+		// cut data into items of varied lengths
+		n := 1 + int(items%16)
+		batch := make([][]byte, n)
+		for i := range batch {
+			cut := 0
+			if len(data) > 0 {
+				cut = int(data[0]) % (len(data) + 1)
+			}
+			batch[i], data = data[:cut], data[cut:]
+		}
+		differential(t, l, base, batch, 1+int(width%32))
+	})
+}
@@ -0,0 +1,94 @@
+package lxr
+
+import (
+	"bytes"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/pegnet/LXRHash/ref"
+)
+
+// The differential tests check every kernel against the reference implementation in package ref
+
+var (
+	diffMtx    sync.Mutex
+	diffTables = make(map[Params]*LXRHash)
+)
+
+// diffHasher returns an LXRHash for p, checking its table against the reference table
+func diffHasher(t testing.TB, p Params) *LXRHash {
+	diffMtx.Lock()
+	defer diffMtx.Unlock()
+	key := p
+	key.HashSize = 0
+	if l, ok := diffTables[key]; ok {
+		l2 := *l
+		l2.HashSize = (p.HashSize + 7) / 8
+		return &l2
+	}
+
+	l, err := New(p, WithEphemeral())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(l.ByteMap, ref.Table(p.Seed, p.Passes, p.MapSizeBits)) {
+		t.Fatalf("%v: table differs from the reference", p)
+	}
+	diffTables[key] = l
+	return l
+}
+
+// differential checks that every kernel agrees with the reference for base followed by each
+// entry of batch
+func differential(t testing.TB, l *LXRHash, base []byte, batch [][]byte, width int) {
+	parallel, err := l.HashBatch(base, batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	batched, err := l.NewBatchHasher(width).Hash(base, batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := make([]byte, l.HashSize)
+	for i, src := range batch {
+		input := append(append([]byte(nil), base...), src...)
+		want := ref.Hash(l.ByteMap, l.Seed, int(l.HashSize), input)
+		for _, got := range []struct {
+			kernel string
+			hash   []byte
+		}{
+			{"Hash", l.Hash(input)},
+			{"FlatHash", l.FlatHash(input)},
+			{"HashPrefixed", l.HashPrefixed(dst, base, src)},
+			{"HashBatch", parallel[i]},
+			{"BatchHasher", batched[i]},
+		} {
+			if !bytes.Equal(got.hash, want) {
+				t.Errorf("%s, %v, input %x: got = %x, want = %x", got.kernel, l.Params(), input, got.hash, want)
+			}
+		}
+	}
+}
+
+func TestDifferential(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	for round := 0; round < 30; round++ {
+		p := Params{
+			Seed:        r.Uint64(),
+			MapSizeBits: MinMapSizeBits + uint64(r.Intn(7)),
+			HashSize:    uint64(1 + r.Intn(600)),
+			Passes:      uint64(1 + r.Intn(6)),
+		}
+		l := diffHasher(t, p)
+
+		base := make([]byte, r.Intn(64))
+		r.Read(base)
+		batch := make([][]byte, 1+r.Intn(24))
+		for i := range batch {
+			batch[i] = make([]byte, r.Intn(96))
+			r.Read(batch[i])
+		}
+		differential(t, l, base, batch, 1+r.Intn(20))
+	}
+}
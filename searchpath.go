@@ -0,0 +1,139 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package lxr
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// TablePathEnv is the environment variable holding directories to search for tables before
+// the system and user table directories, separated by os.PathListSeparator.
+const TablePathEnv = "LXRHASH_TABLE_PATH"
+
+// SystemTablePath returns the directory shared by all users of the host for hash table files:
+//
+//	Windows: %ProgramData%/LXRHash
+//	macOS:   /Library/Application Support/org.pegnet.LXRHash
+//	Linux:   /var/lib/LXRHash
+//	BSD:     /var/db/LXRHash
+//
+// Returns "" on other platforms.
+func SystemTablePath() string {
+	switch runtime.GOOS {
+	case "windows":
+		programData := os.Getenv("ProgramData")
+		if programData == "" {
+			programData = `C:\ProgramData`
+		}
+		return filepath.Join(programData, "LXRHash")
+	case "darwin":
+		return "/Library/Application Support/org.pegnet.LXRHash"
+	case "linux":
+		return "/var/lib/LXRHash"
+	case "freebsd", "openbsd", "netbsd", "dragonfly":
+		return "/var/db/LXRHash"
+	}
+	return ""
+}
+
+// TableSearchPath returns the directories searched for hash table files, in order: those in
+// the LXRHASH_TABLE_PATH environment variable, the system table path, then the user table path.
+func TableSearchPath() ([]string, error) {
+	var dirs []string
+	for _, dir := range filepath.SplitList(os.Getenv(TablePathEnv)) {
+		if dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	if dir := SystemTablePath(); dir != "" {
+		dirs = append(dirs, dir)
+	}
+	userDir, err := GetUserTablePath()
+	if err != nil && len(dirs) == 0 {
+		return nil, err
+	}
+	if err == nil {
+		dirs = append(dirs, userDir)
+	}
+	return dirs, nil
+}
+
+// readTableFromSearchPath uses the first valid table found in dirs.  If there is none, the
+// table is generated and written to the first writable directory; with WithNoGenerate, the
+// error from the first invalid table found is returned instead, or ErrTableNotFound.
+func (lx *LXRHash) readTableFromSearchPath(dirs []string) (string, error) {
+	filename := lx.Params().TableFilename()
+	start := time.Now()
+	var invalid error // from the first table found but not used
+	for _, dir := range dirs {
+		filepath := path.Join(dir, filename)
+		dat, legacy, err := lx.readTableFile(filepath)
+		if err == nil {
+			lx.ByteMap = dat
+			if legacy && lx.upgradeLegacy && !lx.noGenerate {
+				// A shared table may be in a directory we can read but not write
+				if err := lx.upgradeTable(filepath, false); err != nil {
+					lx.log().Warn("upgrading legacy table failed", "path", filepath, "error", err)
+				}
+			}
+			if err = lx.tableLoaded(); err == nil {
+				lx.log().Info("table loaded", "path", filepath, "duration", time.Since(start))
+				return filepath, nil
+			}
+			lx.Close()
+			if te, ok := err.(*TableError); ok && te.Path == "" {
+				te.Path = filepath
+			}
+		}
+		if tableMissing(err) {
+			continue
+		}
+		lx.log().Warn("skipping table", "path", filepath, "error", err)
+		if invalid == nil {
+			invalid = err
+		}
+	}
+
+	searched := strings.Join(dirs, string(os.PathListSeparator))
+	if lx.noGenerate {
+		if invalid != nil {
+			return "", invalid
+		}
+		return "", &TableError{Op: "search", Path: searched, Kind: ErrTableNotFound}
+	}
+	for _, dir := range dirs {
+		if writableDir(dir) {
+			return lx.readTableFromPath(dir)
+		}
+		lx.log().Debug("table directory not writable", "path", dir)
+	}
+	return "", &TableError{Op: "search", Path: searched, Kind: ErrTableDirUnwritable}
+}
+
+// tableMissing reports whether err means there is no table file, including when a
+// directory on the search path is not a directory at all
+func tableMissing(err error) bool {
+	return errors.Is(err, os.ErrNotExist) || errors.Is(err, syscall.ENOTDIR)
+}
+
+// writableDir creates dir if need be, and reports whether files can be created in it
+func writableDir(dir string) bool {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return false
+	}
+	f, err := ioutil.TempFile(dir, ".lxrhash-probe")
+	if err != nil {
+		return false
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return true
+}
@@ -0,0 +1,184 @@
+package lxr
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTableSearchPath(t *testing.T) {
+	old, had := os.LookupEnv(TablePathEnv)
+	defer func() {
+		if had {
+			os.Setenv(TablePathEnv, old)
+		} else {
+			os.Unsetenv(TablePathEnv)
+		}
+	}()
+
+	os.Setenv(TablePathEnv, "/a"+string(os.PathListSeparator)+string(os.PathListSeparator)+"/b")
+	dirs, err := TableSearchPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, _ := GetUserTablePath()
+	want := []string{"/a", "/b"}
+	if sys := SystemTablePath(); sys != "" {
+		want = append(want, sys)
+	}
+	want = append(want, user)
+	if len(dirs) != len(want) {
+		t.Fatalf("got = %q, want = %q", dirs, want)
+	}
+	for i := range want {
+		if dirs[i] != want[i] {
+			t.Errorf("got = %q, want = %q", dirs, want)
+		}
+	}
+}
+
+func TestWithSearchPath(t *testing.T) {
+	root, err := ioutil.TempDir("", "lxrsearch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	// a regular file is not a writable directory
+	blocked := filepath.Join(root, "blocked")
+	if err := ioutil.WriteFile(blocked, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	first, second := filepath.Join(root, "first"), filepath.Join(root, "second")
+	dirs := []string{blocked, first, second}
+	p := Params{Seed: Seed, MapSizeBits: 10, HashSize: HashSize, Passes: Passes}
+
+	// nothing anywhere, so generated into the first writable directory
+	l, err := New(p, WithSearchPath(dirs...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(first, p.TableFilename())); err != nil {
+		t.Errorf("table not generated in the first writable directory: %v", err)
+	}
+
+	// found in a later directory, and nothing written to earlier ones
+	if err := os.Rename(first, second); err != nil {
+		t.Fatal(err)
+	}
+	l2, err := New(p, WithSearchPath(dirs...), WithNoGenerate())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(l.ByteMap, l2.ByteMap) {
+		t.Errorf("table read incorrectly")
+	}
+	if _, err := os.Stat(first); !os.IsNotExist(err) {
+		t.Errorf("found table but wrote to an earlier directory: %v", err)
+	}
+
+	// an invalid table is skipped
+	if err := os.MkdirAll(first, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(first, p.TableFilename()), []byte("junk"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	l3, err := New(p, WithSearchPath(dirs...), WithNoGenerate())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(l.ByteMap, l3.ByteMap) {
+		t.Errorf("table read incorrectly")
+	}
+
+	if _, err := New(p, WithSearchPath(blocked), WithNoGenerate()); !errors.Is(err, ErrTableNotFound) {
+		t.Errorf("no table: got = %v, want = %v", err, ErrTableNotFound)
+	}
+	if _, err := New(p, WithSearchPath(blocked)); !errors.Is(err, ErrTableDirUnwritable) {
+		t.Errorf("nowhere to write: got = %v, want = %v", err, ErrTableDirUnwritable)
+	}
+}
+
+func TestWithSearchPath_Invalid(t *testing.T) {
+	root, err := ioutil.TempDir("", "lxrsearch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	first, second := filepath.Join(root, "first"), filepath.Join(root, "second")
+	p := Params{Seed: Seed, MapSizeBits: 10, HashSize: HashSize, Passes: Passes}
+	for _, dir := range []string{first, second} {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(first, p.TableFilename()), []byte("junk"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// only an invalid table, which is reported rather than taken for a missing one
+	_, err = New(p, WithSearchPath(first, second), WithNoGenerate())
+	if !errors.Is(err, ErrTableCorrupt) || errors.Is(err, ErrTableNotFound) {
+		t.Errorf("corrupt table: got = %v, want = %v", err, ErrTableCorrupt)
+	}
+
+	// a table with a valid header but the wrong fingerprint is skipped for a later valid one
+	good, err := NewFromPath(p, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad, err := New(p, WithEphemeral())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad.ByteMap[0], bad.ByteMap[1] = bad.ByteMap[1], bad.ByteMap[0]
+	bad.haveChecksum = false
+	if err := bad.writeTable(filepath.Join(first, p.TableFilename())); err != nil {
+		t.Fatal(err)
+	}
+	l, err := New(p, WithSearchPath(first, second), WithNoGenerate())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(l.ByteMap, good.ByteMap) {
+		t.Errorf("table read incorrectly")
+	}
+
+	// and reported if there is no other
+	_, err = New(p, WithSearchPath(first), WithNoGenerate())
+	if !errors.Is(err, ErrFingerprintMismatch) {
+		t.Errorf("wrong fingerprint: got = %v, want = %v", err, ErrFingerprintMismatch)
+	}
+}
+
+func TestLoadTable_WithSearchPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lxrsearch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := Params{Seed: Seed, MapSizeBits: 9, HashSize: HashSize, Passes: Passes}
+	l, err := New(p, WithSearchPath(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append([]byte(nil), l.ByteMap...)
+	if err := os.Remove(filepath.Join(dir, p.TableFilename())); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.LoadTable(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, p.TableFilename())); err != nil {
+		t.Errorf("LoadTable ignored the search path: %v", err)
+	}
+	if !bytes.Equal(l.ByteMap, want) {
+		t.Errorf("table read incorrectly")
+	}
+}
@@ -18,21 +18,26 @@ var prt chan string
 
 var LX *lxr.LXRHash
 
-func mine(useLXR bool, data []byte) uint64 {
+func mine(useLXR bool, data []byte) {
 
 	cd := uint64(0)
+	nonce := make([]byte, 0, 8)
+	hash := make([]byte, sha256.Size)
+	if useLXR {
+		hash = make([]byte, LX.HashSize)
+	}
 	dlen := len(data)
 	for i := 0; ; i++ {
-		data = data[:dlen]
+		nonce = nonce[:0]
 		for b := i; b > 0; b = b >> 8 {
-			data = append(data, byte(b))
+			nonce = append(nonce, byte(b))
 		}
-		var hash []byte
 		if useLXR {
-			hash = LX.Hash(data)
+			LX.HashPrefixed(hash, data[:dlen], nonce)
 		} else {
+			data = append(data[:dlen], nonce...)
 			h := sha256.Sum256(data)
-			hash = h[:]
+			copy(hash, h[:])
 		}
 
 		total++
@@ -49,7 +54,6 @@ func mine(useLXR bool, data []byte) uint64 {
 
 		}
 	}
-	return cd
 }
 
 func main() {
@@ -81,8 +85,9 @@ func main() {
 				fmt.Println(err)
 				leave()
 			}
-			if b > 40 || b < 8 {
-				fmt.Println("Bits specified must be at least 8 and less than or equal to 40.  40 bits is 1 TB")
+			if uint64(b) > lxr.MaxMapSizeBits || uint64(b) < lxr.MinMapSizeBits {
+				fmt.Println("Bits specified must be at least 8 and less than or equal to 34.  34 bits is 16 GB")
+				leave()
 			}
 			bits = uint64(b)
 		}
@@ -1,7 +1,6 @@
 package lxr
 
 import (
-	"fmt"
 	"sync"
 )
 
@@ -19,31 +18,46 @@ func init() {
 
 // Init provides access to shared instances of LXRHash without having to instantiate multiple bytemaps.
 // Two separate calls to Init() will result in a reference to the same object.
+//
+// Panics on error.  Use NewShared to get an error instead.
 func Init(seed, bitsize, hashsize, passes uint64) *LXRHash {
-	if bitsize < 8 {
-		panic("bitsize must be at least 8")
+	lxr, err := NewShared(Params{Seed: seed, MapSizeBits: bitsize, HashSize: hashsize, Passes: passes})
+	if err != nil {
+		panic(err)
+	}
+	return lxr
+}
+
+// NewShared provides access to shared instances of LXRHash without having to instantiate multiple bytemaps.
+// Two separate calls to NewShared() with the same parameters will result in a reference to the same object.
+// Every successful call must be paired with a call to Release.
+func NewShared(p Params, opts ...Option) (*LXRHash, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
 	}
 
 	instanceMtx.Lock()
 	defer instanceMtx.Unlock()
 
-	id := fmt.Sprintf("%d-%d-%d-%d", seed, bitsize, hashsize, passes)
-
-	counter[id]++
+	id := p.ID()
 
 	if instance, ok := instances[id]; ok {
-		return instance
+		counter[id]++
+		return instance, nil
 	}
 
-	lxr := new(LXRHash)
-	lxr.Verbose(true)
-	lxr.Init(seed, bitsize, hashsize, passes)
+	lxr := newWithOptions(opts)
+	if err := lxr.initFromSearchPath(p); err != nil {
+		return nil, err
+	}
 	instances[id] = lxr
-	return lxr
+	counter[id]++
+	return lxr, nil
 }
 
 // Release releases a singleton. If all references to the singleton have been released, the singleton is destroyed
-// and can be garbage collected
+// and can be garbage collected.  A memory mapped ByteMap (see WithMmap and WithOffHeap) is unmapped at that point, so the
+// instance must not be used after its last Release.
 func Release(hash *LXRHash) {
 	if hash == nil {
 		return
@@ -51,7 +65,7 @@ func Release(hash *LXRHash) {
 	instanceMtx.Lock()
 	defer instanceMtx.Unlock()
 
-	id := fmt.Sprintf("%d-%d-%d-%d", hash.Seed, hash.MapSizeBits, hash.HashSize*8, hash.Passes)
+	id := hash.Params().ID()
 	test, exists := instances[id]
 	if !exists || test != hash {
 		panic("tried to release a non-singleton instance")
@@ -60,5 +74,10 @@ func Release(hash *LXRHash) {
 	if counter[id] == 0 {
 		delete(counter, id)
 		delete(instances, id)
+		if hash.mapping != nil {
+			if err := hash.Close(); err != nil {
+				hash.log().Error("releasing table failed", "error", err)
+			}
+		}
 	}
 }
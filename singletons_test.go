@@ -2,6 +2,7 @@ package lxr
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"testing"
 )
@@ -73,3 +74,13 @@ func TestRelease(t *testing.T) {
 		t.Errorf("original singleton was destroyed during release")
 	}
 }
+
+func TestNewShared_BadMapSize(t *testing.T) {
+	refs := len(counter)
+	if _, err := NewShared(Params{Seed: Seed, MapSizeBits: 7, HashSize: HashSize, Passes: Passes}); !errors.Is(err, ErrBadMapSize) {
+		t.Errorf("got = %v, want = %v", err, ErrBadMapSize)
+	}
+	if len(counter) != refs {
+		t.Errorf("failed NewShared left references behind: %v", counter)
+	}
+}
@@ -0,0 +1,55 @@
+# The LXRHash round.  kernels_gen.go is generated from this file and kernels.go.tmpl with
+#
+#     go generate
+#
+# Each round is a list of assignments to the state: as, s1, s2 and s3, the intermediate result
+# hs for the current byte of the hash, and locals declared with :=.  v2 is the input value and
+# B(x) is the ByteMap byte at x masked to the map size.  "rotate" rolls s1, s2 and s3 along.
+#
+# Comments after // are kept in the serial kernels; a line holding only a comment is kept as
+# "_ = 0 // comment" so go fmt leaves the comments aligned.  Blank lines separate groups.
+
+fast:
+b := B(as ^ v2)
+as = as<<7 ^ as>>5 ^ v2<<20 ^ v2<<16 ^ v2 ^ b<<20 ^ b<<12 ^ b<<4
+s1 = s1<<9 ^ s1>>3 ^ hs
+hs = s1 ^ as
+rotate
+
+step:
+s1 = s1<<9 ^ s1>>1 ^ as ^ B(as>>5^v2)<<3      // Shifts are not random.  They are selected to ensure that
+s1 = s1<<5 ^ s1>>3 ^ B(s1^v2)<<7              // Prior bytes pulled from the ByteMap contribute to the
+s1 = s1<<7 ^ s1>>7 ^ B(as^s1>>7)<<5           // next access of the ByteMap, either by contributing to
+s1 = s1<<11 ^ s1>>5 ^ B(v2^as>>11^s1)<<27     // the lower bits of the index, or in the upper bits that
+//                                               move the access further in the map.
+hs = s1 ^ as ^ hs<<7 ^ hs>>13                 //
+//                                               We also pay attention not only to where the ByteMap bits
+as = as<<17 ^ as>>5 ^ s1 ^ B(as^s1>>27^v2)<<3 // are applied, but what bits we use in the indexing of
+as = as<<13 ^ as>>3 ^ B(as^s1)<<7             // the ByteMap
+as = as<<15 ^ as>>7 ^ B(as>>7^s1)<<11         //
+as = as<<9 ^ as>>11 ^ B(v2^as^s1)<<3          // Tests run against this set of shifts show that the
+//                                               bytes pulled from the ByteMap are evenly distributed
+s1 = s1<<7 ^ s1>>27 ^ as ^ B(as>>3)<<13       // over possible byte values (0-255) and indexes into
+s1 = s1<<3 ^ s1>>13 ^ B(s1^v2)<<11            // the ByteMap are also evenly distributed, and the
+s1 = s1<<8 ^ s1>>11 ^ B(as^s1>>11)<<9         // deltas between bytes provided map to a curve expected
+s1 = s1<<6 ^ s1>>9 ^ B(v2^as^s1)<<3           // (fewer maximum and minimum deltas, and most deltas around
+//                                               zero.
+as = as<<23 ^ as>>3 ^ s1 ^ B(as^v2^s1>>3)<<7
+as = as<<17 ^ as>>7 ^ B(as^s1>>3)<<5
+as = as<<13 ^ as>>5 ^ B(as>>5^s1)<<1
+as = as<<11 ^ as>>1 ^ B(v2^as^s1)<<7
+
+s1 = s1<<5 ^ s1>>3 ^ as ^ B(as>>7^s1>>3)<<6
+s1 = s1<<8 ^ s1>>6 ^ B(s1^v2)<<11
+s1 = s1<<11 ^ s1>>11 ^ B(as^s1>>11)<<5
+s1 = s1<<7 ^ s1>>5 ^ B(v2^as>>7^as^s1)<<17
+
+s2 = s2<<3 ^ s2>>17 ^ s1 ^ B(as^s2>>5^v2)<<13
+s2 = s2<<6 ^ s2>>13 ^ B(s2)<<11
+s2 = s2<<11 ^ s2>>11 ^ B(as^s1^s2>>11)<<23
+s2 = s2<<4 ^ s2>>23 ^ B(v2^as>>8^as^s2>>10)<<1
+
+s1 = s2<<3 ^ s2>>1 ^ hs ^ v2
+as = as<<9 ^ as>>7 ^ s1>>1 ^ B(s2>>1^hs)<<5
+
+rotate
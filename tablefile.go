@@ -0,0 +1,268 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package lxr
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Table files start with a header that describes the ByteMap that follows, so a file
+// generated for other parameters, or damaged on disk, is detected on load.
+//
+//	offset  size  field
+//	     0     8  magic "LXRTABLE"
+//	     8     4  format version
+//	    12     4  generator version
+//	    16     8  seed
+//	    24     8  passes
+//	    32     8  map size in bits
+//	    40    32  SHA-256 of the ByteMap
+//	    72       zero padding up to TableHeaderSize
+//
+// All integers are big endian.  The header is padded to a full page so the ByteMap is
+// page aligned within the file.
+//
+// Legacy files hold only the ByteMap, with no header.  They are recognized by their size.
+const (
+	TableFormatVersion = uint32(1)  // Version of the table file layout
+	GeneratorVersion   = uint32(1)  // Version of the GenerateTable algorithm
+	TableHeaderSize    = 4096       // Size of the header in bytes, including padding
+	tableMagic         = "LXRTABLE" // First bytes of every table file with a header
+	tableHeaderUsed    = 8 + 4 + 4 + 24 + sha256.Size
+)
+
+// TableHeader describes the ByteMap stored in a table file
+type TableHeader struct {
+	FormatVersion    uint32
+	GeneratorVersion uint32
+	Seed             uint64
+	Passes           uint64
+	MapSizeBits      uint64
+	Checksum         [sha256.Size]byte // SHA-256 of the ByteMap
+}
+
+// header returns the table file header for the current ByteMap.  The checksum is computed
+// afresh, and the cached fingerprint updated, in case the ByteMap was changed in place.
+func (lx *LXRHash) header() TableHeader {
+	lx.checksum, lx.haveChecksum = sha256.Sum256(lx.ByteMap), true
+	return TableHeader{
+		FormatVersion:    TableFormatVersion,
+		GeneratorVersion: GeneratorVersion,
+		Seed:             lx.Seed,
+		Passes:           lx.Passes,
+		MapSizeBits:      lx.MapSizeBits,
+		Checksum:         lx.checksum,
+	}
+}
+
+// MarshalBinary encodes the header, including padding, in TableHeaderSize bytes
+func (h TableHeader) MarshalBinary() ([]byte, error) {
+	data := make([]byte, TableHeaderSize)
+	copy(data, tableMagic)
+	binary.BigEndian.PutUint32(data[8:], h.FormatVersion)
+	binary.BigEndian.PutUint32(data[12:], h.GeneratorVersion)
+	binary.BigEndian.PutUint64(data[16:], h.Seed)
+	binary.BigEndian.PutUint64(data[24:], h.Passes)
+	binary.BigEndian.PutUint64(data[32:], h.MapSizeBits)
+	copy(data[40:], h.Checksum[:])
+	return data, nil
+}
+
+// UnmarshalBinary decodes a header.  Only the format version is checked; use Check
+// to compare the header to a hash.
+func (h *TableHeader) UnmarshalBinary(data []byte) error {
+	if len(data) < TableHeaderSize || !bytes.Equal(data[:len(tableMagic)], []byte(tableMagic)) {
+		return corrupt("no table header")
+	}
+	h.FormatVersion = binary.BigEndian.Uint32(data[8:])
+	if h.FormatVersion != TableFormatVersion {
+		return corrupt("unsupported format version %d", h.FormatVersion)
+	}
+	h.GeneratorVersion = binary.BigEndian.Uint32(data[12:])
+	h.Seed = binary.BigEndian.Uint64(data[16:])
+	h.Passes = binary.BigEndian.Uint64(data[24:])
+	h.MapSizeBits = binary.BigEndian.Uint64(data[32:])
+	copy(h.Checksum[:], data[40:])
+	for _, b := range data[tableHeaderUsed:TableHeaderSize] {
+		if b != 0 {
+			return corrupt("bad header padding")
+		}
+	}
+	return nil
+}
+
+// Check verifies that the header describes the ByteMap for the parameters p,
+// and that byteMap matches the checksum.
+func (h TableHeader) Check(p Params, byteMap []byte) error {
+	switch {
+	case h.GeneratorVersion != GeneratorVersion:
+		return corrupt("generator version is %d, want %d", h.GeneratorVersion, GeneratorVersion)
+	case h.Seed != p.Seed:
+		return corrupt("seed is %#x, want %#x", h.Seed, p.Seed)
+	case h.Passes != p.Passes:
+		return corrupt("passes is %d, want %d", h.Passes, p.Passes)
+	case h.MapSizeBits != p.MapSizeBits:
+		return corrupt("map size is %d bits, want %d", h.MapSizeBits, p.MapSizeBits)
+	case uint64(len(byteMap)) != uint64(1)<<p.MapSizeBits:
+		return corrupt("size is %d bytes, want %d", len(byteMap), uint64(1)<<p.MapSizeBits)
+	}
+	if sum := sha256.Sum256(byteMap); sum != h.Checksum {
+		return corrupt("checksum is %x, want %x", sum, h.Checksum)
+	}
+	return nil
+}
+
+// corrupt returns a TableError of kind ErrTableCorrupt.  The path is filled in by the caller.
+func corrupt(format string, args ...interface{}) error {
+	return &TableError{Op: "check", Kind: ErrTableCorrupt, Err: fmt.Errorf(format, args...)}
+}
+
+// NewFromTable creates an LXRHash with the given parameters using table as the ByteMap.  The
+// table must be the right size for the parameters; with WithFingerprint it must also match the
+// fingerprint.  The table is used directly, not copied, unless WithOffHeap is given, so it
+// must not be changed afterwards: Fingerprint would no longer describe it.
+func NewFromTable(p Params, table []byte, opts ...Option) (*LXRHash, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	lx := newWithOptions(opts)
+	lx.setParams(p)
+	if uint64(len(table)) != lx.MapSize {
+		return nil, corrupt("size is %d bytes, want %d", len(table), lx.MapSize)
+	}
+	if lx.wantOffHeap() {
+		lx.ByteMap = lx.allocTable(len(table))
+		copy(lx.ByteMap, table)
+	} else {
+		lx.ByteMap = table
+	}
+	if err := lx.tableLoaded(); err != nil {
+		lx.Close()
+		return nil, err
+	}
+	return lx, nil
+}
+
+// NewFromReader creates an LXRHash with the given parameters, reading the ByteMap from r in
+// the table file format, see ReadFrom.
+func NewFromReader(p Params, r io.Reader, opts ...Option) (*LXRHash, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	lx := newWithOptions(opts)
+	lx.setParams(p)
+	if _, err := lx.ReadFrom(r); err != nil {
+		return nil, err
+	}
+	return lx, nil
+}
+
+// ReadFrom replaces the ByteMap with one read from r in the table file format, checking the
+// header.  A legacy table, with no header, is also accepted.  Reads exactly one table from r.
+// On error the current ByteMap, if any, is left in place.
+func (lx *LXRHash) ReadFrom(r io.Reader) (int64, error) {
+	magic := make([]byte, len(tableMagic))
+	n, err := io.ReadFull(r, magic)
+	read := int64(n)
+	if err != nil {
+		return read, readError(err)
+	}
+
+	var h TableHeader
+	legacy := !bytes.Equal(magic, []byte(tableMagic))
+	if !legacy {
+		head := make([]byte, TableHeaderSize)
+		copy(head, magic)
+		n, err := io.ReadFull(r, head[len(magic):])
+		read += int64(n)
+		if err != nil {
+			return read, readError(err)
+		}
+		if err := h.UnmarshalBinary(head); err != nil {
+			return read, err
+		}
+	}
+
+	// Read into new memory, so the current ByteMap survives a failure
+	table, mapped := lx.newTable(int(lx.MapSize))
+	start := 0
+	if legacy {
+		start = copy(table, magic)
+	}
+	n, err = io.ReadFull(r, table[start:])
+	read += int64(n)
+	if err == nil && !legacy {
+		err = h.Check(lx.Params(), table)
+	}
+	if err != nil {
+		err = readError(err)
+	} else {
+		if legacy {
+			h.Checksum = sha256.Sum256(table)
+		}
+		err = lx.checkFingerprint(h.Checksum)
+	}
+	if err != nil {
+		if mapped {
+			munmap(table)
+		}
+		return read, err
+	}
+
+	lx.Close()
+	lx.ByteMap = table
+	if mapped {
+		lx.mapping = table
+	}
+	lx.checksum, lx.haveChecksum = h.Checksum, true
+	lx.tuneMemory()
+	return read, nil
+}
+
+// readError classifies an error reading a table from a stream
+func readError(err error) error {
+	if _, ok := err.(*TableError); ok {
+		return err
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return corrupt("table is truncated")
+	}
+	return &TableError{Op: "read", Kind: ErrTableUnreadable, Err: err}
+}
+
+// WriteTo writes the ByteMap to w in the table file format: a header followed by the ByteMap.
+func (lx *LXRHash) WriteTo(w io.Writer) (int64, error) {
+	header, _ := lx.header().MarshalBinary()
+	n, err := w.Write(header)
+	written := int64(n)
+	if err != nil {
+		return written, err
+	}
+	bufSize := 4096 // 4KiB
+	for i := 0; i < len(lx.ByteMap); i += bufSize {
+		j := i + bufSize
+		if j > len(lx.ByteMap) {
+			j = len(lx.ByteMap)
+		}
+		n, err := w.Write(lx.ByteMap[i:j])
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// tableLoaded finishes loading a ByteMap: its fingerprint is verified, then the memory
+// options are applied.
+func (lx *LXRHash) tableLoaded() error {
+	if err := lx.verifyFingerprint(); err != nil {
+		return err
+	}
+	lx.tuneMemory()
+	return nil
+}
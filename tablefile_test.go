@@ -0,0 +1,284 @@
+package lxr
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+)
+
+func TestTableHeader_Marshal(t *testing.T) {
+	l := new(LXRHash)
+	l.setParams(Params{Seed: Seed, MapSizeBits: 8, HashSize: HashSize, Passes: Passes})
+	l.GenerateTable()
+
+	h := l.header()
+	data, err := h.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != TableHeaderSize {
+		t.Errorf("header size: got = %d, want = %d", len(data), TableHeaderSize)
+	}
+
+	var h2 TableHeader
+	if err := h2.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if h != h2 {
+		t.Errorf("round trip: got = %+v, want = %+v", h2, h)
+	}
+	if err := h2.Check(l.Params(), l.ByteMap); err != nil {
+		t.Errorf("check: %v", err)
+	}
+
+	other := l.Params()
+	other.Seed++
+	if err := h2.Check(other, l.ByteMap); !errors.Is(err, ErrTableCorrupt) {
+		t.Errorf("wrong seed: got = %v, want = %v", err, ErrTableCorrupt)
+	}
+
+	damaged := append([]byte(nil), l.ByteMap...)
+	damaged[17] ^= 1
+	if err := h2.Check(l.Params(), damaged); !errors.Is(err, ErrTableCorrupt) {
+		t.Errorf("bit flip: got = %v, want = %v", err, ErrTableCorrupt)
+	}
+
+	data[8] = 0xFF
+	if err := h2.UnmarshalBinary(data); !errors.Is(err, ErrTableCorrupt) {
+		t.Errorf("bad version: got = %v, want = %v", err, ErrTableCorrupt)
+	}
+}
+
+func TestReadTableFile_Checksum(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lxrtables")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := Params{Seed: Seed, MapSizeBits: 10, HashSize: HashSize, Passes: Passes}
+	l, err := NewFromPath(p, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(dir, p.TableFilename())
+
+	// flip a bit of the body, keeping the size
+	dat, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dat[TableHeaderSize+100] ^= 0x80
+	if err := ioutil.WriteFile(name, dat, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := l.readTableFile(name); !errors.Is(err, ErrTableCorrupt) {
+		t.Errorf("bit flip: got = %v, want = %v", err, ErrTableCorrupt)
+	}
+
+	// and it gets regenerated
+	l2, err := NewFromPath(p, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(l.ByteMap, l2.ByteMap) {
+		t.Errorf("regenerated table differs")
+	}
+	if _, legacy, err := l.readTableFile(name); err != nil || legacy {
+		t.Errorf("regenerated file: legacy = %v, err = %v", legacy, err)
+	}
+}
+
+func TestReadTableFile_Legacy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lxrtables")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := Params{Seed: Seed, MapSizeBits: 10, HashSize: HashSize, Passes: Passes}
+	l := new(LXRHash)
+	l.setParams(p)
+	l.GenerateTable()
+	name := filepath.Join(dir, p.TableFilename())
+	l.OldWriteTable(name)
+
+	l2, err := NewFromPath(p, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(l.ByteMap, l2.ByteMap) {
+		t.Errorf("legacy table read incorrectly")
+	}
+	if _, legacy, err := l.readTableFile(name); err != nil || !legacy {
+		t.Errorf("legacy file was changed: legacy = %v, err = %v", legacy, err)
+	}
+
+	l3, err := NewFromPath(p, dir, WithLegacyUpgrade())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(l.ByteMap, l3.ByteMap) {
+		t.Errorf("legacy table read incorrectly")
+	}
+	if _, legacy, err := l.readTableFile(name); err != nil || legacy {
+		t.Errorf("legacy file was not upgraded: legacy = %v, err = %v", legacy, err)
+	}
+}
+
+func TestNewFromTable(t *testing.T) {
+	p := Params{Seed: Seed, MapSizeBits: 10, HashSize: HashSize, Passes: Passes}
+	gen := new(LXRHash)
+	gen.setParams(p)
+	gen.GenerateTable()
+
+	l, err := NewFromTable(p, gen.ByteMap, WithFingerprint(sha256.Sum256(gen.ByteMap)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := l.Hash([]byte("foo")), gen.Hash([]byte("foo")); !bytes.Equal(got, want) {
+		t.Errorf("hash: got = %x, want = %x", got, want)
+	}
+
+	if _, err := NewFromTable(p, gen.ByteMap[1:]); !errors.Is(err, ErrTableCorrupt) {
+		t.Errorf("short table: got = %v, want = %v", err, ErrTableCorrupt)
+	}
+	if _, err := NewFromTable(p, gen.ByteMap, WithFingerprint([32]byte{1})); !errors.Is(err, ErrFingerprintMismatch) {
+		t.Errorf("wrong fingerprint: got = %v, want = %v", err, ErrFingerprintMismatch)
+	}
+
+	// A table changed after loading is written with a header matching what was written
+	other := Params{Seed: Seed + 1, MapSizeBits: 10, HashSize: HashSize, Passes: Passes}
+	table := append([]byte(nil), gen.ByteMap...)
+	l2, err := NewFromTable(other, table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l2.Fingerprint()
+	table[0], table[1] = table[1], table[0]
+	var buf bytes.Buffer
+	if _, err := l2.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFromReader(other, &buf); err != nil {
+		t.Errorf("reading a table changed before writing: %v", err)
+	}
+	if l2.Fingerprint() != sha256.Sum256(table) {
+		t.Errorf("fingerprint not updated when writing")
+	}
+
+	bad := p
+	bad.Passes = 0
+	if _, err := NewFromTable(bad, gen.ByteMap); !errors.Is(err, ErrBadPasses) {
+		t.Errorf("bad params: got = %v, want = %v", err, ErrBadPasses)
+	}
+}
+
+func TestReadFrom(t *testing.T) {
+	p := Params{Seed: Seed, MapSizeBits: 10, HashSize: HashSize, Passes: Passes}
+	gen := new(LXRHash)
+	gen.setParams(p)
+	gen.GenerateTable()
+
+	var buf bytes.Buffer
+	n, err := gen.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(TableHeaderSize+len(gen.ByteMap)) || n != int64(buf.Len()) {
+		t.Errorf("written: got = %d, want = %d", n, TableHeaderSize+len(gen.ByteMap))
+	}
+	file := buf.Bytes()
+
+	l, err := NewFromReader(p, bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(l.ByteMap, gen.ByteMap) {
+		t.Error("read table differs from written table")
+	}
+
+	// legacy tables have no header
+	if _, err := NewFromReader(p, bytes.NewReader(gen.ByteMap)); err != nil {
+		t.Errorf("legacy: %v", err)
+	}
+
+	other := p
+	other.Seed++
+	if _, err := NewFromReader(other, bytes.NewReader(file)); !errors.Is(err, ErrTableCorrupt) {
+		t.Errorf("wrong params: got = %v, want = %v", err, ErrTableCorrupt)
+	}
+	if _, err := NewFromReader(p, bytes.NewReader(file[:len(file)-1])); !errors.Is(err, ErrTableCorrupt) {
+		t.Errorf("truncated: got = %v, want = %v", err, ErrTableCorrupt)
+	}
+	if _, err := NewFromReader(p, iotest.TimeoutReader(bytes.NewReader(file))); !errors.Is(err, ErrTableUnreadable) {
+		t.Errorf("read error: got = %v, want = %v", err, ErrTableUnreadable)
+	}
+}
+
+func TestReadFrom_Failure(t *testing.T) {
+	p := Params{Seed: Seed, MapSizeBits: 10, HashSize: HashSize, Passes: Passes}
+	gen := new(LXRHash)
+	gen.setParams(p)
+	gen.GenerateTable()
+	var buf bytes.Buffer
+	if _, err := gen.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	file := buf.Bytes()
+
+	// a table for other parameters, with a valid header
+	other := new(LXRHash)
+	other.setParams(Params{Seed: Seed + 1, MapSizeBits: 10, HashSize: HashSize, Passes: Passes})
+	other.GenerateTable()
+	var otherBuf bytes.Buffer
+	if _, err := other.WriteTo(&otherBuf); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, opts := range [][]Option{nil, {WithOffHeap()}} {
+		l, err := NewFromReader(p, bytes.NewReader(file), append(opts, WithFingerprint(gen.Fingerprint()))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := l.Hash(oprhash)
+
+		// a failed read leaves the table in place
+		for _, tt := range []struct {
+			name string
+			r    *bytes.Reader
+			kind error
+		}{
+			{"truncated", bytes.NewReader(file[:len(file)-1]), ErrTableCorrupt},
+			{"other params", bytes.NewReader(otherBuf.Bytes()), ErrTableCorrupt},
+			{"legacy with another fingerprint", bytes.NewReader(other.ByteMap), ErrFingerprintMismatch},
+		} {
+			if _, err := l.ReadFrom(tt.r); !errors.Is(err, tt.kind) {
+				t.Errorf("%s: got = %v, want = %v", tt.name, err, tt.kind)
+			}
+			if !bytes.Equal(l.ByteMap, gen.ByteMap) || !bytes.Equal(l.Hash(oprhash), want) {
+				t.Errorf("%s: table lost", tt.name)
+			}
+		}
+		if _, err := l.ReadFrom(iotest.TimeoutReader(bytes.NewReader(file))); !errors.Is(err, ErrTableUnreadable) {
+			t.Errorf("read error: got = %v, want = %v", err, ErrTableUnreadable)
+		}
+		if !bytes.Equal(l.Hash(oprhash), want) {
+			t.Error("read error: table lost")
+		}
+
+		// and a successful one replaces it
+		if _, err := l.ReadFrom(bytes.NewReader(file)); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(l.Hash(oprhash), want) || l.Fingerprint() != gen.Fingerprint() {
+			t.Error("table read incorrectly")
+		}
+		l.Close()
+	}
+}
@@ -4,6 +4,8 @@ package lxr
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -21,16 +23,54 @@ const (
 	firstv    = uint64(3523455478921636871)
 )
 
-// Verbose enables or disables the output of progress indicators to the console
+// Verbose enables or disables the output of progress indicators to the console.
+// A logger set on the instance, with WithLogger or the SetLogger method, takes precedence;
+// one set for the package with SetLogger does not.
 func (lx *LXRHash) Verbose(val bool) {
 	lx.verbose = val
 }
 
-// Log is a wrapper function that only prints information when verbose is enabled
+// Log sends msg to the logger of the instance at info level.  Nothing is printed unless
+// verbose is enabled or a logger is set.
 func (lx *LXRHash) Log(msg string) {
-	if lx.verbose {
-		fmt.Println(msg)
+	lx.log().Info(msg)
+}
+
+// New creates an LXRHash with the given parameters, reading the ByteMap from the first valid table
+// found on the table search path (see TableSearchPath).  If there is none, it is generated and saved
+// in the first writable directory of the search path.
+//
+// Unlike Init, New does not panic. Failures are returned as errors that can be inspected with
+// errors.Is against ErrBadMapSize, ErrNoTablePath, ErrTableUnreadable, ErrTableCorrupt and
+// ErrTableDirUnwritable.
+func New(p Params, opts ...Option) (*LXRHash, error) {
+	lx := newWithOptions(opts)
+	if err := lx.initFromSearchPath(p); err != nil {
+		return nil, err
+	}
+	return lx, nil
+}
+
+// NewFromPath creates an LXRHash with the given parameters, reading the ByteMap from
+// the directory TablePath, which must exist.  See InitFromPath.
+func NewFromPath(p Params, TablePath string, opts ...Option) (*LXRHash, error) {
+	lx := newWithOptions(opts)
+	if _, err := os.Stat(TablePath); err != nil && !lx.ephemeral {
+		return nil, &TableError{Op: "stat", Path: TablePath, Kind: ErrNoTablePath, Err: err}
+	}
+	if _, err := lx.initFromPath(p, TablePath); err != nil {
+		return nil, err
+	}
+	return lx, nil
+}
+
+// newWithOptions returns an uninitialized LXRHash with the options applied
+func newWithOptions(opts []Option) *LXRHash {
+	lx := new(LXRHash)
+	for _, opt := range opts {
+		opt(lx)
 	}
+	return lx
 }
 
 // Init initializes the hash with the given values
@@ -44,13 +84,11 @@ func (lx *LXRHash) Log(msg string) {
 // HashSize is the number of bits in the hash; truncated to a byte bountry
 // Passes is the number of shuffles of the ByteMap performed.  Each pass shuffles all byte values in the map
 //
-// Panics when MapSizeBits is < 8 and on other error conditions
+// The table is found, or generated, on the table search path (see TableSearchPath).
+//
+// Panics when the parameters are invalid (see Params.Validate) and on other error conditions.  Use New to get an error instead.
 func (lx *LXRHash) Init(Seed, MapSizeBits, HashSize, Passes uint64) {
-	tablePath, err := GetUserTablePath()
-	if err != nil {
-		panic(err)
-	}
-	if _, err = lx.initFromPath(Seed, MapSizeBits, HashSize, Passes, tablePath); err != nil {
+	if err := lx.initFromSearchPath(Params{Seed, MapSizeBits, HashSize, Passes}); err != nil {
 		panic(err)
 	}
 }
@@ -71,38 +109,83 @@ func (lx *LXRHash) Init(Seed, MapSizeBits, HashSize, Passes uint64) {
 //
 func (lx *LXRHash) InitFromPath(Seed, MapSizeBits, HashSize, Passes uint64, TablePath string) (string, error) {
 	if _, err := os.Stat(TablePath); err != nil {
-		return "", err
+		return "", &TableError{Op: "stat", Path: TablePath, Kind: ErrNoTablePath, Err: err}
 	}
-	return lx.initFromPath(Seed, MapSizeBits, HashSize, Passes, TablePath)
+	return lx.initFromPath(Params{Seed, MapSizeBits, HashSize, Passes}, TablePath)
 }
 
 // ReadTable attempts to load the ByteMap from disk.
 // If that doesn't exist, a new one will be generated and saved.
+//
+// Panics on error.  Use LoadTable to get an error instead.
 func (lx *LXRHash) ReadTable() {
-	lxrHashPath, err := GetUserTablePath()
-	if err != nil {
+	if err := lx.LoadTable(); err != nil {
 		panic(err)
 	}
-	if err = os.MkdirAll(lxrHashPath, os.ModePerm); err != nil {
-		panic(fmt.Sprintf("Could not create the directory %s", lxrHashPath))
-	}
-	if _, err = lx.readTableFromPath(lxrHashPath); err != nil {
-		panic(err)
+}
+
+// LoadTable attempts to load the ByteMap from the table search path (see TableSearchPath and
+// WithSearchPath).  If that doesn't exist, a new one will be generated and saved.
+func (lx *LXRHash) LoadTable() error {
+	dirs, err := lx.tableSearchPath()
+	if err != nil {
+		return err
 	}
+	_, err = lx.readTableFromSearchPath(dirs)
+	return err
+}
+
+// Close releases the ByteMap.  A memory mapped or off heap ByteMap is unmapped, after which the hash,
+// and any copies of it, must not be used.
+func (lx *LXRHash) Close() error {
+	err := lx.releaseMapping()
+	lx.ByteMap = nil
+	lx.haveChecksum = false
+	return err
 }
 
 // WriteTable caches the bytemap to disk so it only has to be generated once
+//
+// Panics on error.  Use SaveTable to get an error instead.
 func (lx *LXRHash) WriteTable(filename string) {
-	if err := lx.writeTable(filename); err != nil {
+	if err := lx.SaveTable(filename); err != nil {
 		panic(err)
 	}
 }
 
+// SaveTable caches the bytemap to disk so it only has to be generated once
+func (lx *LXRHash) SaveTable(filename string) error {
+	return lx.writeTable(filename)
+}
+
+// Progress reports how far GenerateTableContext has got
+type Progress struct {
+	Pass    uint64        // Current pass, counting from 0
+	Passes  uint64        // Number of passes
+	Index   uint64        // Index reached in the current pass
+	Size    uint64        // Size of the ByteMap
+	Percent float64       // Percent complete over all passes
+	Elapsed time.Duration // Time since generation started
+	ETA     time.Duration // Estimated time remaining
+}
+
+// progressInterval is how often, in ByteMap indexes, GenerateTableContext checks for
+// cancellation and reports progress.  Must be a power of 2.
+const progressInterval = 1 << 20
+
 // GenerateTable generates the bytemap.
 // Initializes the map with an incremental sequence of bytes,
 // then does P passes, shuffling each element in a deterministic manner.
 func (lx *LXRHash) GenerateTable() {
-	lx.ByteMap = make([]byte, int(lx.MapSize))
+	lx.GenerateTableContext(context.Background(), nil)
+}
+
+// GenerateTableContext generates the bytemap like GenerateTable, returning ctx.Err() early if
+// ctx is cancelled, in which case the ByteMap is released.  If progress is not nil, it is
+// called regularly during the shuffle and at the end of each pass.
+func (lx *LXRHash) GenerateTableContext(ctx context.Context, progress func(Progress)) error {
+	lx.ByteMap = lx.allocTable(int(lx.MapSize))
+	lx.haveChecksum = false
 	// Our own "random" generator that really is just used to shuffle values
 	offset := lx.Seed ^ firstrand
 	b := lx.Seed ^ firstb
@@ -119,42 +202,94 @@ func (lx *LXRHash) GenerateTable() {
 
 	// Fill the ByteMap with bytes ranging from 0 to 255.  As long as Mapsize%256 == 0, this
 	// looping and masking works just fine.
-	lx.Log("Initializing the Table")
+	lx.log().Debug("initializing table", "bits", lx.MapSizeBits)
 	for i := range lx.ByteMap {
 		lx.ByteMap[i] = byte(i)
 	}
 
+	start := time.Now()
+	report := func(pass uint64, i uint64) {
+		if progress == nil {
+			return
+		}
+		p := Progress{Pass: pass, Passes: lx.Passes, Index: i, Size: lx.MapSize, Elapsed: time.Since(start)}
+		done := float64(pass*lx.MapSize+i) / float64(lx.Passes*lx.MapSize)
+		p.Percent = 100 * done
+		if done > 0 {
+			p.ETA = time.Duration(float64(p.Elapsed) * (1 - done) / done)
+		}
+		progress(p)
+	}
+
 	// Now what we want to do is just mix it all up.  Take every byte in the ByteMap list, and exchange it
 	// for some other byte in the ByteMap list. Note that we do this over and over, mixing and more mixing
 	// the ByteMap, but maintaining the ratio of each byte value in the ByteMap list.
-	lx.Log("Shuffling the Table")
+	lx.log().Debug("shuffling table", "passes", lx.Passes)
 	period := time.Now().Unix()
 	for loops := 0; loops < int(lx.Passes); loops++ {
-		lx.Log(fmt.Sprintf("Pass %d", loops))
+		lx.log().Debug("shuffle pass", "pass", loops)
 		for i := range lx.ByteMap {
 			if (i+1)%1000 == 0 && time.Now().Unix()-period > 10 {
-				lx.Log(fmt.Sprintf(" Index %10d Meg of %10d Meg -- Pass is %5.1f%% Complete", i/1024000, len(lx.ByteMap)/1024000, 100*float64(i)/float64(len(lx.ByteMap))))
+				lx.log().Info("generating table", "pass", loops, "index", i, "size", len(lx.ByteMap), "percent", fmt.Sprintf("%.1f", 100*float64(i)/float64(len(lx.ByteMap))))
 				period = time.Now().Unix()
 			}
+			if i&(progressInterval-1) == 0 && i > 0 {
+				if err := ctx.Err(); err != nil {
+					lx.releaseMapping()
+					lx.ByteMap = nil
+					return err
+				}
+				report(uint64(loops), uint64(i))
+			}
 
 			j := rand(uint64(i))
 			lx.ByteMap[i], lx.ByteMap[j] = lx.ByteMap[j], lx.ByteMap[i]
 		}
-		lx.Log(fmt.Sprintf(" Index %10d Meg of %10d Meg -- Pass is %5.1f%% Complete", len(lx.ByteMap)/1024000, len(lx.ByteMap)/1024000, float64(100)))
+		lx.log().Info("generating table", "pass", loops, "index", len(lx.ByteMap), "size", len(lx.ByteMap), "percent", "100.0")
+		report(uint64(loops), lx.MapSize)
+		if err := ctx.Err(); err != nil {
+			lx.releaseMapping()
+			lx.ByteMap = nil
+			return err
+		}
+	}
+	return nil
+}
+
+// initFromSearchPath initializes the hash from the table search path, see TableSearchPath
+func (lx *LXRHash) initFromSearchPath(p Params) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	lx.setParams(p)
+	if lx.ephemeral {
+		return lx.generateInMemory()
+	}
+	dirs, err := lx.tableSearchPath()
+	if err != nil {
+		return err
 	}
+	_, err = lx.readTableFromSearchPath(dirs)
+	return err
 }
 
-func (lx *LXRHash) initFromPath(Seed, MapSizeBits, HashSize, Passes uint64, TablePath string) (string, error) {
-	if MapSizeBits < 8 {
-		return "", fmt.Errorf("Bad Map Size in Bits.  Must be between 8 and 34 bits, was %d", MapSizeBits)
+// tableSearchPath returns the directories given by WithSearchPath, or else TableSearchPath
+func (lx *LXRHash) tableSearchPath() ([]string, error) {
+	if len(lx.searchPath) > 0 {
+		return lx.searchPath, nil
 	}
+	return TableSearchPath()
+}
 
-	MapSize := uint64(1) << MapSizeBits
-	lx.HashSize = (HashSize + 7) / 8
-	lx.MapSize = MapSize
-	lx.MapSizeBits = MapSizeBits
-	lx.Seed = Seed
-	lx.Passes = Passes
+func (lx *LXRHash) initFromPath(p Params, TablePath string) (string, error) {
+	if err := p.Validate(); err != nil {
+		return "", err
+	}
+
+	lx.setParams(p)
+	if lx.ephemeral {
+		return "", lx.generateInMemory()
+	}
 	lxrhashtablepath, err := lx.readTableFromPath(TablePath)
 	if err != nil {
 		return "", err
@@ -162,71 +297,274 @@ func (lx *LXRHash) initFromPath(Seed, MapSizeBits, HashSize, Passes uint64, Tabl
 	return lxrhashtablepath, nil
 }
 
+// setParams sets the hash parameters without touching the ByteMap
+func (lx *LXRHash) setParams(p Params) {
+	lx.HashSize = (p.HashSize + 7) / 8
+	lx.MapSize = uint64(1) << p.MapSizeBits
+	lx.MapSizeBits = p.MapSizeBits
+	lx.Seed = p.Seed
+	lx.Passes = p.Passes
+}
+
+// generateInMemory generates the table without reading or writing any files
+func (lx *LXRHash) generateInMemory() error {
+	lx.log().Info("generating table in memory", "bits", lx.MapSizeBits, "passes", lx.Passes)
+	start := time.Now()
+	if err := lx.GenerateTableContext(lx.context(), lx.progress); err != nil {
+		return err
+	}
+	if err := lx.tableLoaded(); err != nil {
+		return err
+	}
+	lx.log().Info("generated table", "duration", time.Since(start))
+	return nil
+}
+
 func (lx *LXRHash) readTableFromPath(tablepath string) (string, error) {
-	filename := fmt.Sprintf("lxrhash-seed-%x-passes-%d-size-%d.dat", lx.Seed, lx.Passes, lx.MapSizeBits)
-	filepath := path.Join(tablepath, filename)
+	filepath := path.Join(tablepath, lx.Params().TableFilename())
 
 	// Try and load our byte map.
-	lx.Log(fmt.Sprintf("Reading ByteMap Table %s", filepath))
+	lx.log().Info("reading table", "path", filepath)
 
 	start := time.Now()
-	dat, err := ioutil.ReadFile(filepath)
-	// If loading fails, or it is the wrong size, generate it.  Otherwise just use it.
-	if err != nil || len(dat) != int(lx.MapSize) {
-		lx.Log("Table not found, Generating ByteMap Table")
-		lx.GenerateTable()
-		lx.Log("Writing ByteMap Table ")
+	dat, legacy, err := lx.readTableFile(filepath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) && !errors.Is(err, ErrTableCorrupt) {
+		return "", err
+	}
+	if err != nil && lx.noGenerate {
+		if os.IsNotExist(err) {
+			return "", &TableError{Op: "read", Path: filepath, Kind: ErrTableNotFound, Err: err}
+		}
+		return "", err
+	}
+
+	// Only one process at a time generates or rewrites a table.  Once we hold the lock, look
+	// again, as another process may have generated the table while we waited.
+	locked := false
+	if err != nil {
+		unlock, lerr := lx.lockTableFile(filepath)
+		if lerr != nil {
+			return "", lerr
+		}
+		defer unlock()
+		locked = true
+		dat, legacy, err = lx.readTableFile(filepath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) && !errors.Is(err, ErrTableCorrupt) {
+			return "", err
+		}
+	}
+
+	// If the table is missing, or it is corrupt, generate it.  Otherwise just use it.
+	if err != nil {
+		if errors.Is(err, ErrTableCorrupt) {
+			lx.log().Warn("table corrupt", "path", filepath, "error", err)
+		}
+		lx.log().Info("generating table", "path", filepath, "bits", lx.MapSizeBits, "passes", lx.Passes)
+		genStart := time.Now()
+		if err := lx.GenerateTableContext(lx.context(), lx.progress); err != nil {
+			return "", err
+		}
+		lx.log().Info("generated table", "duration", time.Since(genStart))
+		lx.log().Info("writing table", "path", filepath)
 		if err := lx.writeTable(filepath); err != nil {
 			return "", err
 		}
+		if err := lx.remapTable(filepath); err != nil {
+			return "", err
+		}
 	} else {
 		lx.ByteMap = dat
+		if legacy && lx.upgradeLegacy && !lx.noGenerate {
+			if err := lx.upgradeTable(filepath, locked); err != nil {
+				return "", err
+			}
+		}
 	}
-	lx.Log(fmt.Sprintf("Finished Reading ByteMap Table. Total time taken: %s", time.Since(start)))
+	if err := lx.tableLoaded(); err != nil {
+		return "", err
+	}
+	lx.log().Info("table loaded", "path", filepath, "duration", time.Since(start))
 	return filepath, nil
 }
 
+// upgradeTable rewrites the legacy table file just loaded with a header, taking the table
+// lock unless the caller holds it
+func (lx *LXRHash) upgradeTable(filepath string, locked bool) error {
+	if !locked {
+		unlock, err := lx.lockTableFile(filepath)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+	lx.log().Info("upgrading legacy table", "path", filepath)
+	if err := lx.writeTable(filepath); err != nil {
+		return err
+	}
+	return lx.remapTable(filepath)
+}
+
+// lockPollInterval is how often lockTableFile retries a lock held by another process
+const lockPollInterval = 100 * time.Millisecond
+
+// lockTableFile takes an exclusive advisory lock that guards generating and writing the table
+// file, waiting while another process holds it, unless the context given by WithContext is
+// done.  The lock is on a separate file next to the table, which is left in place.  Call the
+// returned function to release the lock.
+func (lx *LXRHash) lockTableFile(filepath string) (unlock func(), err error) {
+	lockPath := filepath + ".lock"
+	if err := os.MkdirAll(path.Dir(lockPath), os.ModePerm); err != nil {
+		return nil, &TableError{Op: "mkdir", Path: path.Dir(lockPath), Kind: ErrTableDirUnwritable, Err: err}
+	}
+	f, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, &TableError{Op: "lock", Path: lockPath, Kind: ErrTableDirUnwritable, Err: err}
+	}
+	ok, err := tryLockFile(f)
+	if err == nil && !ok {
+		lx.log().Info("waiting for another process to write the table", "lock", lockPath)
+		ctx := lx.context()
+		for err == nil && !ok {
+			select {
+			case <-ctx.Done():
+				f.Close()
+				return nil, ctx.Err()
+			case <-time.After(lockPollInterval):
+			}
+			ok, err = tryLockFile(f)
+		}
+	}
+	if err != nil {
+		f.Close()
+		return nil, &TableError{Op: "lock", Path: lockPath, Kind: ErrTableDirUnwritable, Err: err}
+	}
+	return func() {
+		unlockFile(f)
+		f.Close()
+	}, nil
+}
+
+// remapTable replaces a ByteMap just written to filepath with a mapping of the file, so
+// the page cache copy is shared rather than kept in the heap.  Does nothing unless
+// memory mapping is in use.
+func (lx *LXRHash) remapTable(filepath string) error {
+	if !lx.useMmap || !mmapSupported {
+		return nil
+	}
+	old := lx.mapping
+	lx.mapping = nil
+	dat, _, err := lx.readTableFile(filepath)
+	if err != nil {
+		lx.mapping = old
+		return err
+	}
+	lx.ByteMap = dat
+	if old != nil {
+		return munmap(old)
+	}
+	return nil
+}
+
+// readTableFile reads a ByteMap table file and checks it against its header.
+// Legacy files without a header are only checked for size; legacy is true for them.
+//
+// If the file is read into mapped memory (see WithMmap and WithOffHeap), the mapping is
+// recorded so Close can release it.
+func (lx *LXRHash) readTableFile(filepath string) (byteMap []byte, legacy bool, err error) {
+	dat, mapped, err := lx.readFile(filepath)
+	if os.IsNotExist(err) {
+		return nil, false, err
+	}
+	if err != nil {
+		return nil, false, &TableError{Op: "read", Path: filepath, Kind: ErrTableUnreadable, Err: err}
+	}
+	defer func() {
+		switch {
+		case err != nil:
+			if mapped {
+				munmap(dat)
+			}
+		case mapped:
+			// Replacing a table already loaded releases its mapping
+			lx.releaseMapping()
+			lx.mapping = dat
+		}
+	}()
+	if uint64(len(dat)) == lx.MapSize {
+		return dat, true, nil
+	}
+
+	var h TableHeader
+	err = h.UnmarshalBinary(dat)
+	if err == nil {
+		err = h.Check(lx.Params(), dat[TableHeaderSize:])
+	}
+	if te, ok := err.(*TableError); ok {
+		te.Path = filepath
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	lx.checksum, lx.haveChecksum = h.Checksum, true
+	return dat[TableHeaderSize:], false, nil
+}
+
+// writeTable writes the table to a temporary file which is synced to disk and then renamed into
+// place, so readers see either no table or a complete one.
 func (lx *LXRHash) writeTable(filepath string) (result error) {
 	tablePath := path.Dir(filepath)
 	if err := os.MkdirAll(tablePath, os.ModePerm); err != nil {
-		return fmt.Errorf("Could not create the directory %s", tablePath)
-	}
-	if err := os.Remove(filepath); err != nil && !os.IsNotExist(err) {
-		return err
+		return &TableError{Op: "mkdir", Path: tablePath, Kind: ErrTableDirUnwritable, Err: err}
 	}
 	// open output file
-	fo, err := os.Create(filepath)
+	fo, err := ioutil.TempFile(tablePath, path.Base(filepath)+".tmp")
 	if err != nil {
-		return err
+		return &TableError{Op: "create", Path: filepath, Kind: ErrTableDirUnwritable, Err: err}
 	}
 
-	// close fo on exit and check for its returned error
+	// clean up the temporary file if anything goes wrong
 	defer func() {
-		if err := fo.Close(); err != nil {
-			result = err
+		if result != nil {
+			fo.Close()
+			os.Remove(fo.Name())
 		}
 	}()
+	if err := fo.Chmod(0644); err != nil {
+		return &TableError{Op: "chmod", Path: fo.Name(), Kind: ErrTableDirUnwritable, Err: err}
+	}
 
-	// write a chunk
+	// write the header, then the table
 	w := bufio.NewWriter(fo)
-	bufSize := 4096 // 4KiB
-	for i := 0; i < len(lx.ByteMap); i += bufSize {
-		j := i + bufSize
-		if j > len(lx.ByteMap) {
-			j = len(lx.ByteMap)
-		}
-		if nn, err := w.Write(lx.ByteMap[i:j]); err != nil {
-			return fmt.Errorf("error writing bytemap to disk: %d bytes written, %v", nn, err)
-		}
+	if n, err := lx.WriteTo(w); err != nil {
+		return &TableError{Op: "write", Path: fo.Name(), Kind: ErrTableDirUnwritable,
+			Err: fmt.Errorf("%d bytes written: %w", n, err)}
 	}
-	err = w.Flush()
-	return err
+	if err = w.Flush(); err != nil {
+		return &TableError{Op: "write", Path: fo.Name(), Kind: ErrTableDirUnwritable, Err: err}
+	}
+	if err = fo.Sync(); err != nil {
+		return &TableError{Op: "sync", Path: fo.Name(), Kind: ErrTableDirUnwritable, Err: err}
+	}
+	if err = fo.Close(); err != nil {
+		return &TableError{Op: "close", Path: fo.Name(), Kind: ErrTableDirUnwritable, Err: err}
+	}
+	if err = os.Rename(fo.Name(), filepath); err != nil {
+		return &TableError{Op: "rename", Path: filepath, Kind: ErrTableDirUnwritable, Err: err}
+	}
+	if err = syncDir(tablePath); err != nil {
+		lx.log().Warn("syncing table directory failed", "path", tablePath, "error", err)
+	}
+	return nil
 }
 
+// GetUserTablePath returns the directory in the user's home directory that holds hash table files
 func GetUserTablePath() (string, error) {
 	u, err := user.Current()
 	if err != nil {
-		return "", err
+		return "", &TableError{Op: "lookup", Path: "~", Kind: ErrNoTablePath, Err: err}
+	}
+	if u.HomeDir == "" {
+		return "", &TableError{Op: "lookup", Path: "~", Kind: ErrNoTablePath, Err: fmt.Errorf("user %s has no home directory", u.Username)}
 	}
 	userTablePath := filepath.Join(u.HomeDir, ".lxrhash")
 	return userTablePath, nil
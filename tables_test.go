@@ -2,8 +2,11 @@ package lxr
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -90,8 +93,19 @@ func compareWrite(t *testing.T, MapSizeBits uint64) {
 		panic(err)
 	}
 
-	if !bytes.Equal(a, b) {
-		t.Errorf("mismatch for %d bits. old = %32x, new = %32x", MapSizeBits, a, b)
+	// the new format is the old one with a header in front
+	if len(b) != len(a)+TableHeaderSize {
+		t.Fatalf("wrong size for %d bits. old = %d, new = %d", MapSizeBits, len(a), len(b))
+	}
+	var h TableHeader
+	if err := h.UnmarshalBinary(b); err != nil {
+		t.Errorf("bad header for %d bits: %v", MapSizeBits, err)
+	} else if err := h.Check(l.Params(), b[TableHeaderSize:]); err != nil {
+		t.Errorf("header mismatch for %d bits: %v", MapSizeBits, err)
+	}
+
+	if !bytes.Equal(a, b[TableHeaderSize:]) {
+		t.Errorf("mismatch for %d bits. old = %32x, new = %32x", MapSizeBits, a, b[TableHeaderSize:])
 	}
 }
 
@@ -101,3 +115,225 @@ func TestLXRHash_WriteTable(t *testing.T) {
 	compareWrite(t, 16)
 	compareWrite(t, 20)
 }
+
+func TestNew_Errors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lxrtables")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := Params{Seed: Seed, MapSizeBits: 8, HashSize: HashSize, Passes: Passes}
+
+	if _, err := NewFromPath(Params{Seed: Seed, MapSizeBits: 7, HashSize: HashSize, Passes: Passes}, dir); !errors.Is(err, ErrBadMapSize) {
+		t.Errorf("bad map size: got = %v, want = %v", err, ErrBadMapSize)
+	}
+
+	if _, err := NewFromPath(p, filepath.Join(dir, "missing")); !errors.Is(err, ErrNoTablePath) {
+		t.Errorf("missing dir: got = %v, want = %v", err, ErrNoTablePath)
+	}
+
+	// a directory where the table file should be can't be read
+	l, err := NewFromPath(p, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unreadable, err := ioutil.TempDir("", "lxrunreadable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(unreadable)
+	if err := os.Mkdir(filepath.Join(unreadable, l.Params().TableFilename()), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFromPath(p, unreadable); !errors.Is(err, ErrTableUnreadable) {
+		t.Errorf("unreadable table: got = %v, want = %v", err, ErrTableUnreadable)
+	}
+
+	// a regular file where the table directory should be can't be written
+	blocker := filepath.Join(dir, "blocker")
+	if err := ioutil.WriteFile(blocker, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.SaveTable(filepath.Join(blocker, "table.dat")); !errors.Is(err, ErrTableDirUnwritable) {
+		t.Errorf("unwritable dir: got = %v, want = %v", err, ErrTableDirUnwritable)
+	}
+	var te *TableError
+	if err := l.SaveTable(filepath.Join(blocker, "table.dat")); !errors.As(err, &te) || te.Err == nil {
+		t.Errorf("unwritable dir: missing underlying cause in %v", err)
+	}
+}
+
+func TestReadTableFile_Corrupt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lxrtables")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := Params{Seed: Seed, MapSizeBits: 8, HashSize: HashSize, Passes: Passes}
+	l, err := NewFromPath(p, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append([]byte(nil), l.ByteMap...)
+
+	name := filepath.Join(dir, p.TableFilename())
+	if err := ioutil.WriteFile(name, want[:100], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := l.readTableFile(name); !errors.Is(err, ErrTableCorrupt) {
+		t.Errorf("short table: got = %v, want = %v", err, ErrTableCorrupt)
+	}
+
+	// a corrupt table is regenerated
+	l2, err := NewFromPath(p, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(l2.ByteMap, want) {
+		t.Errorf("regenerated table differs")
+	}
+}
+
+func TestGenerateTableContext(t *testing.T) {
+	l := new(LXRHash)
+	l.setParams(Params{Seed: Seed, MapSizeBits: 21, HashSize: HashSize, Passes: 2})
+
+	var reports []Progress
+	if err := l.GenerateTableContext(context.Background(), func(p Progress) { reports = append(reports, p) }); err != nil {
+		t.Fatal(err)
+	}
+
+	// one report half way through each pass, and one at its end
+	if len(reports) != 4 {
+		t.Fatalf("got %d progress reports, want 4: %+v", len(reports), reports)
+	}
+	for i, p := range reports {
+		if p.Passes != 2 || p.Size != l.MapSize {
+			t.Errorf("report %d: wrong totals %+v", i, p)
+		}
+		if i > 0 && p.Percent <= reports[i-1].Percent {
+			t.Errorf("report %d: percent went from %f to %f", i, reports[i-1].Percent, p.Percent)
+		}
+	}
+	if last := reports[len(reports)-1]; last.Percent != 100 || last.ETA != 0 {
+		t.Errorf("final report %+v", last)
+	}
+
+	plain := new(LXRHash)
+	plain.setParams(l.Params())
+	plain.GenerateTable()
+	if !bytes.Equal(plain.ByteMap, l.ByteMap) {
+		t.Errorf("GenerateTableContext and GenerateTable differ")
+	}
+
+	// cancel at the first report
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := l.GenerateTableContext(ctx, func(Progress) { cancel() }); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled: got = %v, want = %v", err, context.Canceled)
+	}
+	if l.ByteMap != nil {
+		t.Errorf("cancelled generation left a ByteMap")
+	}
+}
+
+func TestNewFromPath_Cancel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lxrtables")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := Params{Seed: Seed, MapSizeBits: 21, HashSize: HashSize, Passes: Passes}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, err := NewFromPath(p, dir, WithContext(ctx), WithProgress(func(Progress) { cancel() })); !errors.Is(err, context.Canceled) {
+		t.Errorf("got = %v, want = %v", err, context.Canceled)
+	}
+	if _, err := os.Stat(filepath.Join(dir, p.TableFilename())); !os.IsNotExist(err) {
+		t.Errorf("cancelled generation wrote a table: %v", err)
+	}
+
+	if !fileLockSupported {
+		return
+	}
+	// cancel while waiting for another process
+	gen := new(LXRHash)
+	gen.setParams(p)
+	unlock, err := gen.lockTableFile(filepath.Join(dir, p.TableFilename()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+	ctx, cancel = context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err := NewFromPath(p, dir, WithContext(ctx)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("waiting: got = %v, want = %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestWithNoGenerate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lxrtables")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := Params{Seed: Seed, MapSizeBits: 10, HashSize: HashSize, Passes: Passes}
+	if _, err := NewFromPath(p, dir, WithNoGenerate()); !errors.Is(err, ErrTableNotFound) || !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing table: got = %v, want = %v", err, ErrTableNotFound)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("files written in no generate mode")
+	}
+
+	l, err := NewFromPath(p, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l2, err := NewFromPath(p, dir, WithNoGenerate())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(l.ByteMap, l2.ByteMap) {
+		t.Errorf("table read incorrectly")
+	}
+
+	name := filepath.Join(dir, p.TableFilename())
+	if err := ioutil.WriteFile(name, l.ByteMap[:10], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFromPath(p, dir, WithNoGenerate()); !errors.Is(err, ErrTableCorrupt) {
+		t.Errorf("corrupt table: got = %v, want = %v", err, ErrTableCorrupt)
+	}
+}
+
+func TestWithEphemeral(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lxrtables")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := Params{Seed: Seed, MapSizeBits: 10, HashSize: HashSize, Passes: Passes}
+	l, err := NewFromPath(p, dir, WithEphemeral())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("files written in ephemeral mode")
+	}
+	if _, err := NewFromPath(p, filepath.Join(dir, "missing"), WithEphemeral()); err != nil {
+		t.Errorf("ephemeral mode needs a table path: %v", err)
+	}
+
+	l2, err := NewFromPath(p, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(l.ByteMap, l2.ByteMap) {
+		t.Errorf("ephemeral table differs")
+	}
+}
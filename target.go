@@ -0,0 +1,64 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package lxr
+
+// A hash meets a mining target if its first 8 bytes, read as a big endian integer, are at
+// least the target.
+//
+// AbortSettings gives the first byte of a hash that can decide this.  It cannot be used to
+// stop hashing early, though: the reduction pass produces the bytes of the hash from the last
+// to the first, so the most significant bytes are only known once every ByteMap access has
+// been made, and reordering the reduction would change every hash.  What is saved on a miss is
+// building the result: HashMeetsTarget does not allocate for a miss, and
+// HashParallelMeetsTarget allocates only for the hits.
+
+// maxStackHash is the largest HashSize, in bytes, that HashMeetsTarget computes without allocating
+const maxStackHash = 64
+
+// HashMeetsTarget hashes src and reports whether the hash meets target.  The hash is only
+// returned if it does, and is then identical to Hash(src).
+func (lx LXRHash) HashMeetsTarget(src []byte, target uint64) (ok bool, hash []byte) {
+	var buf [maxStackHash]byte
+	dst := buf[:]
+	if lx.HashSize > maxStackHash {
+		dst = make([]byte, lx.HashSize)
+	}
+	dst = lx.HashInto(dst, src)
+	if !MeetsTarget(dst, target) {
+		return false, nil
+	}
+	return true, append([]byte(nil), dst...)
+}
+
+// HashParallelMeetsTarget hashes base followed by each entry of batch, as HashParallel does,
+// and reports which hashes meet target.  Only the hashes that do are returned; the others
+// are nil.  The errors are those of HashBatch.
+func (lx LXRHash) HashParallelMeetsTarget(base []byte, batch [][]byte, target uint64) (ok []bool, hashes [][]byte, err error) {
+	bh := getBatchHasher(&lx, DefaultBatchWidth)
+	defer putBatchHasher(bh)
+	results, err := bh.Hash(base, batch)
+	if err != nil {
+		return nil, nil, err
+	}
+	ok = make([]bool, len(results))
+	hashes = make([][]byte, len(results))
+	for i, h := range results {
+		if ok[i] = MeetsTarget(h, target); ok[i] {
+			hashes[i] = append([]byte(nil), h...)
+		}
+	}
+	return ok, hashes, nil
+}
+
+// MeetsTarget reports whether hash meets target.  A hash shorter than 8 bytes is padded
+// with zeros.
+func MeetsTarget(hash []byte, target uint64) bool {
+	var v uint64
+	for i := 0; i < 8; i++ {
+		v <<= 8
+		if i < len(hash) {
+			v |= uint64(hash[i])
+		}
+	}
+	return v >= target
+}
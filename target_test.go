@@ -0,0 +1,81 @@
+package lxr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestMeetsTarget(t *testing.T) {
+	tests := []struct {
+		hash   []byte
+		target uint64
+		want   bool
+	}{
+		{[]byte{0xff, 0xac, 0x55, 0xc6, 0x9e, 0xca, 0xbf, 0x4f, 0}, 0xffac55c69ecabf4f, true},
+		{[]byte{0xff, 0xac, 0x55, 0xc6, 0x9e, 0xca, 0xbf, 0x4e, 0xff}, 0xffac55c69ecabf4f, false},
+		{[]byte{0xff, 0xad}, 0xffac55c69ecabf4f, true},
+		{[]byte{0xff, 0xab, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, 0xffac55c69ecabf4f, false},
+		{[]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, 0xffffffffffffffff, true},
+		{[]byte{}, 0, true},
+	}
+	for _, tt := range tests {
+		if got := MeetsTarget(tt.hash, tt.target); got != tt.want {
+			t.Errorf("MeetsTarget(%x, %x): got = %v, want = %v", tt.hash, tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestHashMeetsTarget(t *testing.T) {
+	batch := make([][]byte, 256)
+	for i := range batch {
+		batch[i] = make([]byte, 4)
+		binary.BigEndian.PutUint32(batch[i], uint32(i))
+	}
+	tgt := uint64(0xf000000000000000) // about 1 in 16 hashes meet this
+
+	hits := 0
+	ok, hashes, err := lx.HashParallelMeetsTarget(oprhash, batch, tgt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, nonce := range batch {
+		want := lx.Hash(append(append([]byte(nil), oprhash...), nonce...))
+		wantOK := target(want) >= tgt
+
+		gotOK, got := lx.HashMeetsTarget(append(append([]byte(nil), oprhash...), nonce...), tgt)
+		if gotOK != wantOK || ok[i] != wantOK {
+			t.Errorf("nonce %x: got = %v, %v, want = %v", nonce, gotOK, ok[i], wantOK)
+		}
+		if !wantOK {
+			if got != nil || hashes[i] != nil {
+				t.Errorf("nonce %x: hash returned for a miss", nonce)
+			}
+			continue
+		}
+		hits++
+		if !bytes.Equal(got, want) || !bytes.Equal(hashes[i], want) {
+			t.Errorf("nonce %x: got = %x, %x, want = %x", nonce, got, hashes[i], want)
+		}
+	}
+	if hits == 0 {
+		t.Error("no hash met the target")
+	}
+
+	miss := append(append([]byte(nil), oprhash...), 0, 0, 0, 0)
+	allocs := testing.AllocsPerRun(100, func() {
+		lx.HashMeetsTarget(miss, 0xffffffffffffffff)
+	})
+	if allocs != 0 {
+		t.Errorf("a miss allocates: %v allocs/op", allocs)
+	}
+
+	// a batch of misses allocates the same however large it is: ok, hashes and the receiver
+	// the pooled BatchHasher points to
+	allocs = testing.AllocsPerRun(10, func() {
+		lx.HashParallelMeetsTarget(oprhash, batch, 0xffffffffffffffff)
+	})
+	if allocs > 3 {
+		t.Errorf("a batch of misses allocates: %v allocs/op, want at most 3", allocs)
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package lxr
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TracePhase is the part of the hash a TraceStep belongs to
+type TracePhase int
+
+// Phases of a hash, in the order they run
+const (
+	TraceFast   TracePhase = iota // First pass over the input, one ByteMap read per byte
+	TraceMain                     // Second pass over the input
+	TraceReduce                   // Reduction of the intermediate results to the hash
+)
+
+func (p TracePhase) String() string {
+	switch p {
+	case TraceFast:
+		return "fast"
+	case TraceMain:
+		return "main"
+	case TraceReduce:
+		return "reduce"
+	}
+	return fmt.Sprintf("TracePhase(%d)", int(p))
+}
+
+// TraceRead is one read of the ByteMap
+type TraceRead struct {
+	Line   int    // Line of step.spec making the read, or 0 for the reads producing a hash byte
+	Index  uint64 // Index read, already masked to the map size
+	Value  byte   // Byte read
+	Result uint64 // Value assigned by the line, once the read is mixed in
+}
+
+// TraceStep is the state of a hash after one step: a byte of input in the first or second
+// pass, or a byte of the hash in the reduction.
+type TraceStep struct {
+	Phase          TracePhase
+	Pos            int         // Position of the input byte, or of the hash byte when reducing
+	Idx            int         // Index of the intermediate result updated, hs[Idx]
+	Input          uint64      // Value stepped in: the input byte, or hs[Pos] when reducing
+	As, S1, S2, S3 uint64      // The accumulated state and the three rolling states
+	HS             []uint64    // The intermediate results
+	Reads          []TraceRead // ByteMap reads made by the step, in order
+	Out            byte        // The hash byte produced, when reducing
+}
+
+// String formats the step on one line, followed by a line for each read, so traces of two
+// implementations can be compared with diff
+func (s *TraceStep) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %d: v2=%x as=%016x s1=%016x s2=%016x s3=%016x hs[%d]=%016x",
+		s.Phase, s.Pos, s.Input, s.As, s.S1, s.S2, s.S3, s.Idx, s.HS[s.Idx])
+	if s.Phase == TraceReduce {
+		fmt.Fprintf(&sb, " out=%02x", s.Out)
+	}
+	for _, r := range s.Reads {
+		fmt.Fprintf(&sb, "\n\tline %d: B[%x]=%02x", r.Line, r.Index, r.Value)
+		if r.Line != 0 {
+			fmt.Fprintf(&sb, " -> %016x", r.Result)
+		}
+	}
+	return sb.String()
+}
+
+// HashTrace returns the hash of src, as Hash does, calling f after every step with the full
+// state and the ByteMap reads the step made.  The step passed to f, and its HS and Reads,
+// are only valid during the call; use Trace to keep them.  This is slow, and meant for finding
+// where another implementation diverges from this one.
+func (lx LXRHash) HashTrace(src []byte, f func(*TraceStep)) []byte {
+	hs := make([]uint64, lx.HashSize)
+	bytes := make([]byte, lx.HashSize)
+	lx.hashTrace(bytes, hs, src, f)
+	return bytes
+}
+
+// Trace returns the hash of src and every step of computing it, see HashTrace
+func (lx LXRHash) Trace(src []byte) ([]byte, []TraceStep) {
+	var steps []TraceStep
+	hash := lx.HashTrace(src, func(st *TraceStep) {
+		s := *st
+		s.HS = append([]uint64(nil), st.HS...)
+		s.Reads = append([]TraceRead(nil), st.Reads...)
+		steps = append(steps, s)
+	})
+	return hash, steps
+}
@@ -0,0 +1,71 @@
+package lxr
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/pegnet/LXRHash/ref"
+)
+
+func TestTrace(t *testing.T) {
+	l := diffHasher(t, Params{Seed: Seed, MapSizeBits: 10, HashSize: 64, Passes: Passes})
+	src := []byte("a trace longer than the hash")
+
+	hash, steps := l.Trace(src)
+	if !bytes.Equal(hash, l.Hash(src)) {
+		t.Fatalf("got = %x, want = %x", hash, l.Hash(src))
+	}
+	if got, want := len(steps), 2*len(src)+int(l.HashSize); got != want {
+		t.Fatalf("steps: got = %d, want = %d", got, want)
+	}
+
+	spec, err := ioutil.ReadFile("step.spec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	specLines := strings.Split(string(spec), "\n")
+
+	reads := map[TracePhase]int{TraceFast: 1, TraceMain: 25, TraceReduce: 27}
+	for i, s := range steps {
+		if len(s.Reads) != reads[s.Phase] {
+			t.Errorf("step %d, %v: got %d reads, want %d", i, s.Phase, len(s.Reads), reads[s.Phase])
+		}
+		for _, r := range s.Reads {
+			if r.Value != l.ByteMap[r.Index] {
+				t.Errorf("step %d: read B[%x] = %x, ByteMap holds %x", i, r.Index, r.Value, l.ByteMap[r.Index])
+			}
+			if r.Line != 0 && !strings.Contains(specLines[r.Line-1], "B(") {
+				t.Errorf("step %d: read on line %d, which is %q", i, r.Line, specLines[r.Line-1])
+			}
+		}
+		if s.Phase == TraceReduce && s.Out != hash[s.Pos] {
+			t.Errorf("step %d: out = %x, want = %x", i, s.Out, hash[s.Pos])
+		}
+	}
+
+	// The state after each pass agrees with the reference
+	_, first, second := ref.HashStates(l.ByteMap, l.Seed, int(l.HashSize), src)
+	for _, pass := range []struct {
+		step TraceStep
+		want ref.State
+	}{
+		{steps[len(src)-1], first},
+		{steps[2*len(src)-1], second},
+	} {
+		got := ref.State{As: pass.step.As, S1: pass.step.S1, S2: pass.step.S2, S3: pass.step.S3, HS: pass.step.HS}
+		if got.As != pass.want.As || got.S1 != pass.want.S1 || got.S2 != pass.want.S2 || got.S3 != pass.want.S3 {
+			t.Errorf("%v %d: got = %+v, want = %+v", pass.step.Phase, pass.step.Pos, got, pass.want)
+		}
+		for i := range got.HS {
+			if got.HS[i] != pass.want.HS[i] {
+				t.Errorf("%v %d: hs[%d] got = %x, want = %x", pass.step.Phase, pass.step.Pos, i, got.HS[i], pass.want.HS[i])
+			}
+		}
+	}
+
+	if s := steps[0].String(); !strings.HasPrefix(s, "fast 0: v2=61 ") || !strings.Contains(s, "\n\tline ") {
+		t.Errorf("String: got %q", s)
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package lxr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+
+	"github.com/pegnet/LXRHash/ref"
+)
+
+// Test vectors are known answers for LXRHash, in a JSON format that implementations in other
+// languages can check themselves against:
+//
+//	{
+//	  "format": "lxrhash-vectors/1",
+//	  "vectors": [
+//	    {
+//	      "params": "0xfafaececfafaecec:10:256:5",
+//	      "fingerprint": "<SHA-256 of the ByteMap, hex>",
+//	      "input": "<hex>",
+//	      "output": "<hex>",
+//	      "states": {
+//	        "first_pass":  {"as": "<hex>", "s1": "<hex>", "s2": "<hex>", "s3": "<hex>", "hs": ["<hex>", ...]},
+//	        "second_pass": {...}
+//	      }
+//	    }
+//	  ]
+//	}
+//
+// Params are in the form seed:bits:hashbits:passes, see ParseParams.  Byte strings are hex,
+// and 64 bit states are 16 hex digits, since JSON numbers cannot hold them exactly.  The
+// states are optional: the state after the first pass over the input and after the second,
+// just before the reduction, to narrow down where an implementation goes wrong.
+
+// VectorFormat identifies the version of the test vector format
+const VectorFormat = "lxrhash-vectors/1"
+
+// VectorFile is a file of test vectors
+type VectorFile struct {
+	Format  string   `json:"format"`
+	Vectors []Vector `json:"vectors"`
+}
+
+// Vector is one known answer: the hash of Input for Params
+type Vector struct {
+	Params      Params        `json:"params"`
+	Fingerprint HexBytes      `json:"fingerprint"` // SHA-256 of the ByteMap
+	Input       HexBytes      `json:"input"`
+	Output      HexBytes      `json:"output"`
+	States      *VectorStates `json:"states,omitempty"`
+}
+
+// VectorStates holds the state of a hash between passes
+type VectorStates struct {
+	FirstPass  VectorState `json:"first_pass"`
+	SecondPass VectorState `json:"second_pass"`
+}
+
+// VectorState is the accumulated state, the three rolling states and the intermediate results
+type VectorState struct {
+	As HexUint64   `json:"as"`
+	S1 HexUint64   `json:"s1"`
+	S2 HexUint64   `json:"s2"`
+	S3 HexUint64   `json:"s3"`
+	HS []HexUint64 `json:"hs"`
+}
+
+// HexBytes is a byte string encoded in JSON as hex
+type HexBytes []byte
+
+// MarshalText encodes the bytes in hex
+func (h HexBytes) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(h)), nil
+}
+
+// UnmarshalText decodes hex
+func (h *HexBytes) UnmarshalText(text []byte) error {
+	b, err := hex.DecodeString(string(text))
+	if err != nil {
+		return err
+	}
+	*h = b
+	return nil
+}
+
+// HexUint64 is a 64 bit integer encoded in JSON as 16 hex digits
+type HexUint64 uint64
+
+// MarshalText encodes the integer as 16 hex digits
+func (h HexUint64) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("%016x", uint64(h))), nil
+}
+
+// UnmarshalText decodes up to 16 hex digits
+func (h *HexUint64) UnmarshalText(text []byte) error {
+	v, err := strconv.ParseUint(string(text), 16, 64)
+	if err != nil {
+		return err
+	}
+	*h = HexUint64(v)
+	return nil
+}
+
+// Vector returns the test vector for input.  With states, the intermediate states are
+// included, computed by the reference implementation in package ref.
+func (lx *LXRHash) Vector(input []byte, states bool) Vector {
+	fp := lx.Fingerprint()
+	v := Vector{
+		Params:      lx.Params(),
+		Fingerprint: fp[:],
+		Input:       append(HexBytes{}, input...),
+		Output:      lx.Hash(input),
+	}
+	if states {
+		_, first, second := ref.HashStates(lx.ByteMap, lx.Seed, int(lx.HashSize), input)
+		v.States = &VectorStates{FirstPass: vectorState(first), SecondPass: vectorState(second)}
+	}
+	return v
+}
+
+// vectorState converts a state of the reference implementation
+func vectorState(st ref.State) VectorState {
+	vs := VectorState{As: HexUint64(st.As), S1: HexUint64(st.S1), S2: HexUint64(st.S2), S3: HexUint64(st.S3)}
+	for _, h := range st.HS {
+		vs.HS = append(vs.HS, HexUint64(h))
+	}
+	return vs
+}
+
+// ReadVectors decodes a file of test vectors, checking its format
+func ReadVectors(r io.Reader) (VectorFile, error) {
+	var f VectorFile
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return VectorFile{}, err
+	}
+	if f.Format != VectorFormat {
+		return VectorFile{}, fmt.Errorf("test vector format is %q, want %q", f.Format, VectorFormat)
+	}
+	return f, nil
+}
+
+// WriteVectors encodes a file of test vectors, one field per line
+func WriteVectors(w io.Writer, vectors []Vector) error {
+	data, err := json.MarshalIndent(VectorFile{Format: VectorFormat, Vectors: vectors}, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// VectorFailure is a test vector an implementation got wrong
+type VectorFailure struct {
+	Index  int    // Index of the vector in the file
+	Vector Vector // The vector
+	Got    []byte // Output of the implementation, if it produced one
+	Err    error  // Error from the implementation, if any
+}
+
+func (f VectorFailure) Error() string {
+	if f.Err != nil {
+		return fmt.Sprintf("vector %d (%v, input %x): %v", f.Index, f.Vector.Params, []byte(f.Vector.Input), f.Err)
+	}
+	return fmt.Sprintf("vector %d (%v, input %x): got = %x, want = %x",
+		f.Index, f.Vector.Params, []byte(f.Vector.Input), f.Got, []byte(f.Vector.Output))
+}
+
+// CheckVectors hashes the input of every vector with hash and returns the vectors it got
+// wrong, in order.  hash is the implementation under test, e.g. the result of VectorHasher.
+func CheckVectors(vectors []Vector, hash func(Vector) ([]byte, error)) []VectorFailure {
+	var failures []VectorFailure
+	for i, v := range vectors {
+		got, err := hash(v)
+		if err != nil || string(got) != string(v.Output) {
+			failures = append(failures, VectorFailure{Index: i, Vector: v, Got: got, Err: err})
+		}
+	}
+	return failures
+}
+
+// VectorHasher returns a function hashing test vectors with this library, for CheckVectors.
+// The table for each parameter set is loaded with New and opts the first time it is needed,
+// and must match the fingerprint of the vector.
+func VectorHasher(opts ...Option) func(Vector) ([]byte, error) {
+	var mtx sync.Mutex
+	tables := make(map[Params]*LXRHash)
+	return func(v Vector) ([]byte, error) {
+		if len(v.Fingerprint) != sha256.Size {
+			return nil, fmt.Errorf("fingerprint is %d bytes, want %d", len(v.Fingerprint), sha256.Size)
+		}
+		var fp [sha256.Size]byte
+		copy(fp[:], v.Fingerprint)
+
+		key := v.Params
+		key.HashSize = 0
+		mtx.Lock()
+		lx, ok := tables[key]
+		if !ok || lx.Fingerprint() != fp {
+			var err error
+			lx, err = New(v.Params, append(opts[:len(opts):len(opts)], WithFingerprint(fp))...)
+			if err != nil {
+				mtx.Unlock()
+				return nil, err
+			}
+			tables[key] = lx
+		}
+		mtx.Unlock()
+
+		sized := *lx
+		sized.HashSize = (v.Params.HashSize + 7) / 8
+		return sized.Hash(v.Input), nil
+	}
+}
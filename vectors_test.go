@@ -0,0 +1,132 @@
+package lxr
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/pegnet/LXRHash/ref"
+)
+
+// readVectorFile reads a file of test vectors from testdata
+func readVectorFile(t *testing.T, name string) []Vector {
+	f, err := os.Open("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	file, err := ReadVectors(f)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	if len(file.Vectors) == 0 {
+		t.Fatalf("%s: no vectors", name)
+	}
+	return file.Vectors
+}
+
+func TestVectors(t *testing.T) {
+	hash := VectorHasher(WithEphemeral())
+	for _, name := range []string{"vectors.json", "vectors-states.json"} {
+		for _, failure := range CheckVectors(readVectorFile(t, name), hash) {
+			t.Errorf("%s: %v", name, failure)
+		}
+	}
+
+	// The default parameters, with the table loaded by init
+	fp := lx.Fingerprint()
+	hash30 := func(v Vector) ([]byte, error) {
+		if v.Params.ID() != lx.Params().ID() || !bytes.Equal(v.Fingerprint, fp[:]) {
+			t.Fatalf("vector for %v, fingerprint %x", v.Params, []byte(v.Fingerprint))
+		}
+		return lx.Hash(v.Input), nil
+	}
+	for _, failure := range CheckVectors(readVectorFile(t, "vectors-30.json"), hash30) {
+		t.Errorf("vectors-30.json: %v", failure)
+	}
+}
+
+func TestVectors_States(t *testing.T) {
+	for _, v := range readVectorFile(t, "vectors-states.json") {
+		if v.States == nil {
+			t.Fatalf("%v, input %x: no states", v.Params, []byte(v.Input))
+		}
+		table := ref.Table(v.Params.Seed, v.Params.Passes, v.Params.MapSizeBits)
+		_, first, second := ref.HashStates(table, v.Params.Seed, int(v.Params.HashSize+7)/8, v.Input)
+		want := VectorStates{FirstPass: vectorState(first), SecondPass: vectorState(second)}
+		for _, pass := range []struct {
+			name      string
+			got, want VectorState
+		}{
+			{"first pass", v.States.FirstPass, want.FirstPass},
+			{"second pass", v.States.SecondPass, want.SecondPass},
+		} {
+			if pass.got.As != pass.want.As || pass.got.S1 != pass.want.S1 || pass.got.S2 != pass.want.S2 ||
+				pass.got.S3 != pass.want.S3 || len(pass.got.HS) != len(pass.want.HS) {
+				t.Errorf("%v, input %x, %s: got = %+v, want = %+v", v.Params, []byte(v.Input), pass.name, pass.got, pass.want)
+				continue
+			}
+			for i := range pass.got.HS {
+				if pass.got.HS[i] != pass.want.HS[i] {
+					t.Errorf("%v, input %x, %s: hs[%d] got = %x, want = %x",
+						v.Params, []byte(v.Input), pass.name, i, pass.got.HS[i], pass.want.HS[i])
+				}
+			}
+		}
+	}
+}
+
+func TestVectors_RoundTrip(t *testing.T) {
+	l := diffHasher(t, Params{Seed: Seed, MapSizeBits: 8, HashSize: 72, Passes: Passes})
+	vectors := []Vector{l.Vector(nil, false), l.Vector([]byte("foo"), true)}
+
+	var buf bytes.Buffer
+	if err := WriteVectors(&buf, vectors); err != nil {
+		t.Fatal(err)
+	}
+	file, err := ReadVectors(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(file.Vectors) != 2 {
+		t.Fatalf("got %d vectors, want 2", len(file.Vectors))
+	}
+	for i, v := range file.Vectors {
+		if v.Params != vectors[i].Params || !bytes.Equal(v.Input, vectors[i].Input) ||
+			!bytes.Equal(v.Output, vectors[i].Output) || !bytes.Equal(v.Fingerprint, vectors[i].Fingerprint) {
+			t.Errorf("vector %d: got = %+v, want = %+v", i, v, vectors[i])
+		}
+		if (v.States == nil) != (vectors[i].States == nil) {
+			t.Errorf("vector %d: states got = %v, want = %v", i, v.States, vectors[i].States)
+		}
+	}
+	if got, want := file.Vectors[1].States.SecondPass.As, vectors[1].States.SecondPass.As; got != want {
+		t.Errorf("second pass as: got = %x, want = %x", got, want)
+	}
+
+	if _, err := ReadVectors(bytes.NewBufferString(`{"format":"lxrhash-vectors/2","vectors":[]}`)); err == nil {
+		t.Error("read an unknown format")
+	}
+}
+
+func TestCheckVectors_Failures(t *testing.T) {
+	l := diffHasher(t, Params{Seed: Seed, MapSizeBits: 8, HashSize: 256, Passes: Passes})
+	good := l.Vector([]byte("good"), false)
+	wrong := l.Vector([]byte("wrong output"), false)
+	wrong.Output = append(HexBytes{}, wrong.Output...)
+	wrong.Output[0] ^= 1
+	otherTable := l.Vector([]byte("wrong fingerprint"), false)
+	otherTable.Fingerprint = make(HexBytes, len(good.Fingerprint))
+
+	failures := CheckVectors([]Vector{good, wrong, otherTable}, VectorHasher(WithEphemeral()))
+	if len(failures) != 2 {
+		t.Fatalf("got %d failures, want 2: %v", len(failures), failures)
+	}
+	if failures[0].Index != 1 || failures[0].Err != nil || bytes.Equal(failures[0].Got, wrong.Output) {
+		t.Errorf("wrong output: got failure %v", failures[0])
+	}
+	if failures[1].Index != 2 || !errors.Is(failures[1].Err, ErrFingerprintMismatch) {
+		t.Errorf("wrong fingerprint: got failure %v, want %v", failures[1], ErrFingerprintMismatch)
+	}
+}